@@ -0,0 +1,75 @@
+package httpbin
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+func notModified(w http.ResponseWriter) {
+	w.Header().Del("Content-Type")
+	w.WriteHeader(http.StatusNotModified)
+}
+
+// CacheHandler returns 304 if an If-Modified-Since or If-None-Match header is
+// present, otherwise the same as GetHandler with Last-Modified and ETag headers.
+func CacheHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("If-Modified-Since") != "" || r.Header.Get("If-None-Match") != "" {
+		notModified(w)
+		return
+	}
+
+	w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+	w.Header().Set("ETag", fmt.Sprintf(`"%s"`, uuid.New().String()))
+	GetHandler(w, r)
+}
+
+// CacheControlHandler sets a Cache-Control header for n seconds.
+func CacheControlHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars == nil {
+		logger.Println("INVALID PATH")
+		return
+	}
+
+	n, err := strconv.Atoi(vars["n"])
+	if err != nil || n < 0 {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid max-age %s", vars["n"]))
+		return
+	}
+
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", n))
+	GetHandler(w, r)
+}
+
+// ETagHandler assumes the resource has the given etag and responds to
+// If-None-Match and If-Match headers appropriately.
+func ETagHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars == nil {
+		logger.Println("INVALID PATH")
+		return
+	}
+	etag := vars["etag"]
+	w.Header().Set("ETag", fmt.Sprintf(`"%s"`, etag))
+
+	// If-None-Match 存在时忽略 If-Match，见 RFC 7232 6
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		if matchEntityTag(parseEntityTags(ifNoneMatch), etag, true) {
+			notModified(w)
+			return
+		}
+	} else if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		if !matchEntityTag(parseEntityTags(ifMatch), etag, false) {
+			w.Header().Del("ETag")
+			writeError(w, http.StatusPreconditionFailed, "Precondition Failed")
+			return
+		}
+	}
+
+	GetHandler(w, r)
+}
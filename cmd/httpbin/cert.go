@@ -0,0 +1,233 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 自签名证书写入目录中的文件名
+const (
+	caCertFile   = "ca.pem"
+	caKeyFile    = "ca-key.pem"
+	leafCertFile = "cert.pem"
+	leafKeyFile  = "key.pem"
+)
+
+// selfSignedCertificate returns the certificate and key files in dir, they
+// are generated when missing: a CA, and a leaf certificate for hosts signed by
+// the CA. Clients can trust ca.pem to verify the server. The leaf certificate
+// is issued again with the existing CA when hosts change, when it has expired
+// or when it was not signed by the CA.
+func selfSignedCertificate(dir string, hosts []string) (certFile, keyFile string, err error) {
+	certFile = filepath.Join(dir, leafCertFile)
+	keyFile = filepath.Join(dir, leafKeyFile)
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", "", err
+	}
+
+	// 客户端已经信任的 CA 只有在不存在时才重新生成，读取失败时不能覆盖它
+	caCert, caKey, err := loadCA(dir)
+	if os.IsNotExist(err) {
+		caCert, caKey, err = generateCA(dir)
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("CA in %s: %s", dir, err)
+	}
+
+	// 已经生成过的证书继续使用，客户端不需要重新信任 CA
+	if pair, err := tls.LoadX509KeyPair(certFile, keyFile); err == nil {
+		leaf, err := x509.ParseCertificate(pair.Certificate[0])
+		if err == nil && reusableLeaf(leaf, caCert, hosts, time.Now()) {
+			return certFile, keyFile, nil
+		}
+	}
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	leafTemplate, err := certificateTemplate("go-httpbin", 365*24*time.Hour)
+	if err != nil {
+		return "", "", err
+	}
+	leafTemplate.KeyUsage = x509.KeyUsageDigitalSignature
+	leafTemplate.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			leafTemplate.IPAddresses = append(leafTemplate.IPAddresses, ip)
+		} else {
+			leafTemplate.DNSNames = append(leafTemplate.DNSNames, host)
+		}
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, caCert, &leafKey.PublicKey, caKey)
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := writePEM(certFile, "CERTIFICATE", leafDER, 0644); err != nil {
+		return "", "", err
+	}
+	if err := writeECKey(keyFile, leafKey); err != nil {
+		return "", "", err
+	}
+
+	log.Printf("Generated self-signed certificate for %v in %s, trust %s to verify it\n",
+		hosts, dir, filepath.Join(dir, caCertFile))
+	return certFile, keyFile, nil
+}
+
+// reusableLeaf reports whether leaf is valid at now, signed by caCert and
+// issued for exactly hosts.
+func reusableLeaf(leaf, caCert *x509.Certificate, hosts []string, now time.Time) bool {
+	if now.Before(leaf.NotBefore) || now.After(leaf.NotAfter) {
+		return false
+	}
+	if leaf.CheckSignatureFrom(caCert) != nil {
+		return false
+	}
+	return sameHosts(leaf, hosts)
+}
+
+// sameHosts reports whether the SANs of cert are exactly hosts.
+func sameHosts(cert *x509.Certificate, hosts []string) bool {
+	sans := make(map[string]bool)
+	for _, name := range cert.DNSNames {
+		sans[strings.ToLower(name)] = true
+	}
+	for _, ip := range cert.IPAddresses {
+		sans[ip.String()] = true
+	}
+
+	wanted := make(map[string]bool)
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			wanted[ip.String()] = true
+		} else {
+			wanted[strings.ToLower(host)] = true
+		}
+	}
+
+	if len(sans) != len(wanted) {
+		return false
+	}
+	for host := range wanted {
+		if !sans[host] {
+			return false
+		}
+	}
+	return true
+}
+
+func loadCA(dir string) (*x509.Certificate, crypto.PrivateKey, error) {
+	pair, err := tls.LoadX509KeyPair(filepath.Join(dir, caCertFile), filepath.Join(dir, caKeyFile))
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, pair.PrivateKey, nil
+}
+
+func generateCA(dir string) (*x509.Certificate, crypto.PrivateKey, error) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	caTemplate, err := certificateTemplate("go-httpbin CA", 10*365*24*time.Hour)
+	if err != nil {
+		return nil, nil, err
+	}
+	caTemplate.IsCA = true
+	caTemplate.BasicConstraintsValid = true
+	caTemplate.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := writePEM(filepath.Join(dir, caCertFile), "CERTIFICATE", caDER, 0644); err != nil {
+		return nil, nil, err
+	}
+	if err := writeECKey(filepath.Join(dir, caKeyFile), caKey); err != nil {
+		return nil, nil, err
+	}
+	return caCert, caKey, nil
+}
+
+func certificateTemplate(commonName string, validFor time.Duration) (*x509.Certificate, error) {
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	notBefore := time.Now().Add(-time.Hour)
+	return &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			Organization: []string{"go-httpbin"},
+			CommonName:   commonName,
+		},
+		NotBefore: notBefore,
+		NotAfter:  notBefore.Add(validFor),
+	}, nil
+}
+
+func writeECKey(filename string, key *ecdsa.PrivateKey) error {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	return writePEM(filename, "EC PRIVATE KEY", der, 0600)
+}
+
+func writePEM(filename, blockType string, der []byte, perm os.FileMode) error {
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	return ioutil.WriteFile(filename, data, perm)
+}
+
+// clientAuthTypes 是 -tls-client-auth 的可选值，客户端证书都需要由 -tls-client-ca 签发
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"none":    tls.NoClientCert,
+	"request": tls.VerifyClientCertIfGiven,
+	"require": tls.RequireAndVerifyClientCert,
+}
+
+func loadCertPool(filename string) (*x509.CertPool, error) {
+	if filename == "" {
+		return nil, errors.New("-tls-client-ca is required to verify client certificates")
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificate found in %s", filename)
+	}
+	return pool, nil
+}
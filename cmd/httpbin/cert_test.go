@@ -0,0 +1,115 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func loadLeaf(certFile, keyFile string) *x509.Certificate {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		log.Fatalln(err)
+	}
+	return leaf
+}
+
+func TestSelfSignedCertificate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpbin-cert")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer os.RemoveAll(dir)
+	hosts := []string{"localhost", "127.0.0.1"}
+
+	certFile, keyFile, err := selfSignedCertificate(dir, hosts)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	first := loadLeaf(certFile, keyFile)
+
+	// 没有变化时继续使用原来的证书
+	if _, _, err := selfSignedCertificate(dir, hosts); err != nil {
+		log.Fatalln(err)
+	}
+	if leaf := loadLeaf(certFile, keyFile); !leaf.Equal(first) {
+		log.Fatalln("Excepted the certificate to be reused")
+	}
+
+	// 过期的证书会用原来的 CA 重新签发
+	caCert, caKey, err := loadCA(dir)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	template, err := certificateTemplate("go-httpbin", time.Hour)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	template.NotBefore = time.Now().Add(-2 * time.Hour)
+	template.NotAfter = time.Now().Add(-time.Hour)
+	template.DNSNames = []string{"localhost"}
+	template.IPAddresses = first.IPAddresses
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &leafKey.PublicKey, caKey)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if err := writePEM(certFile, "CERTIFICATE", der, 0644); err != nil {
+		log.Fatalln(err)
+	}
+	if err := writeECKey(keyFile, leafKey); err != nil {
+		log.Fatalln(err)
+	}
+
+	if _, _, err := selfSignedCertificate(dir, hosts); err != nil {
+		log.Fatalln(err)
+	}
+	leaf := loadLeaf(certFile, keyFile)
+	if time.Now().After(leaf.NotAfter) || leaf.CheckSignatureFrom(caCert) != nil {
+		log.Fatalf("Unexcepted certificate valid until %s\n", leaf.NotAfter)
+	}
+
+	// CA 重新生成后证书也要重新签发
+	os.Remove(filepath.Join(dir, caCertFile))
+	os.Remove(filepath.Join(dir, caKeyFile))
+	if _, _, err := selfSignedCertificate(dir, hosts); err != nil {
+		log.Fatalln(err)
+	}
+	newCA, _, err := loadCA(dir)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if newCA.Equal(caCert) {
+		log.Fatalln("Excepted a new CA")
+	}
+	if err := loadLeaf(certFile, keyFile).CheckSignatureFrom(newCA); err != nil {
+		log.Fatalf("Excepted certificate signed by the new CA: %s\n", err)
+	}
+
+	// 无法读取的 CA 不会被覆盖
+	caFile := filepath.Join(dir, caCertFile)
+	if err := ioutil.WriteFile(caFile, []byte("broken"), 0644); err != nil {
+		log.Fatalln(err)
+	}
+	if _, _, err := selfSignedCertificate(dir, hosts); err == nil {
+		log.Fatalln("Excepted error for a broken CA")
+	}
+	if data, _ := ioutil.ReadFile(caFile); string(data) != "broken" {
+		log.Fatalln("Excepted the broken CA to be kept")
+	}
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/BurntSushi/toml"
+	"github.com/bwangelme/go-httpbin"
+	"github.com/bwangelme/go-httpbin/middlewares"
+	"gopkg.in/yaml.v2"
+)
+
+// 设置的来源按优先级从低到高依次为：默认值、配置文件、环境变量、命令行参数。
+// 每个设置都是一个命令行参数，环境变量名是 HTTPBIN_ 加上大写的参数名，
+// 例如 -read-timeout 对应 HTTPBIN_READ_TIMEOUT，配置文件中的键和参数名相同。
+
+const envPrefix = "HTTPBIN_"
+
+// 这些参数只能在命令行中设置，-config 也可以使用 HTTPBIN_CONFIG
+const (
+	configFlag      = "config"
+	printConfigFlag = "print-config"
+)
+
+// stringList is a comma separated list, setting it replaces the previous value
+// so a flag overrides the list of the config file instead of extending it.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = nil
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+func (l *stringList) Get() interface{} {
+	return append([]string{}, *l...)
+}
+
+type config struct {
+	Listen       stringList
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+	ShutdownTime time.Duration
+
+	MaxBodySize    int64
+	MaxBytes       int64
+	MaxStreamBytes int64
+	TemplateDir    string
+	StaticDir      string
+	Groups         stringList
+
+	AccessLog       string
+	AccessLogFormat string
+	LogFile         string
+
+	JWT                  middlewares.JWTConfig
+	JWTGroups            stringList
+	RedirectAllowedHosts stringList
+	RedirectDeniedHosts  stringList
+	RedirectRelativeOnly bool
+	TrustedProxies       stringList
+	TrustedProxyHeader   string
+
+	TLSCert       string
+	TLSKey        string
+	TLSSelfSigned string
+	TLSHosts      stringList
+	HTTP2         bool
+	TLSClientAuth string
+	TLSClientCA   string
+}
+
+func defaultConfig() *config {
+	return &config{
+		Listen:       stringList{"localhost:8080"},
+		ReadTimeout:  15 * time.Second,
+		WriteTimeout: 15 * time.Second,
+		IdleTimeout:  30 * time.Second,
+		ShutdownTime: 15 * time.Second,
+
+		MaxBodySize:    httpbin.MAX_BODY_SIZE,
+		MaxBytes:       httpbin.MAX_BYTES,
+		MaxStreamBytes: httpbin.MAX_STREAM_BYTES,
+		TemplateDir:    "templates",
+		StaticDir:      "static",
+
+		AccessLog:       "-",
+		AccessLogFormat: "common",
+
+		TrustedProxyHeader: "X-Forwarded-For",
+
+		TLSHosts:      stringList{"localhost", "127.0.0.1", "::1"},
+		HTTP2:         true,
+		TLSClientAuth: "none",
+	}
+}
+
+func (c *config) registerFlags(fs *flag.FlagSet) {
+	fs.Var(&c.Listen, "listen", "监听地址，逗号分隔，可以同时监听多个地址")
+	fs.DurationVar(&c.ReadTimeout, "read-timeout", c.ReadTimeout, "读取请求的超时时间")
+	fs.DurationVar(&c.WriteTimeout, "write-timeout", c.WriteTimeout, "写入响应的超时时间")
+	fs.DurationVar(&c.IdleTimeout, "idle-timeout", c.IdleTimeout, "keep-alive 连接的空闲超时时间")
+	fs.DurationVar(&c.ShutdownTime, "shutdownTime", c.ShutdownTime, "服务器被关闭时的等待时间")
+
+	fs.Int64Var(&c.MaxBodySize, "max-body-size", c.MaxBodySize, "读取请求体的最大字节数，0 表示不限制")
+	fs.Int64Var(&c.MaxBytes, "max-bytes", c.MaxBytes, "/bytes 返回的最大字节数")
+	fs.Int64Var(&c.MaxStreamBytes, "max-stream-bytes", c.MaxStreamBytes, "/stream-bytes 返回的最大字节数")
+	fs.StringVar(&c.TemplateDir, "template-dir", c.TemplateDir, "模板目录")
+	fs.StringVar(&c.StaticDir, "static-dir", c.StaticDir, "静态文件目录")
+	fs.Var(&c.Groups, "groups", "开启的接口分组，逗号分隔，例如 http-methods,auth，为空时开启所有分组")
+
+	fs.StringVar(&c.AccessLog, "access-log", c.AccessLog, "访问日志文件，- 表示标准输出，off 表示关闭")
+	fs.StringVar(&c.AccessLogFormat, "access-log-format", c.AccessLogFormat, "访问日志格式，可选 common、combined")
+	fs.StringVar(&c.LogFile, "log-file", c.LogFile, "程序日志文件，为空时输出到标准输出")
+
+	fs.StringVar(&c.JWT.KeyFile, "jwt-keys", c.JWT.KeyFile, "JWT 公钥文件，可以是 JWKS 或 PEM，和 -jwt-secret 都为空时不开启 JWT 认证")
+	fs.StringVar(&c.JWT.SecretFile, "jwt-secret", c.JWT.SecretFile, "JWT HS256 密钥文件")
+	fs.StringVar(&c.JWT.Audience, "jwt-audience", c.JWT.Audience, "校验 JWT 的 aud")
+	fs.StringVar(&c.JWT.Issuer, "jwt-issuer", c.JWT.Issuer, "校验 JWT 的 iss")
+	fs.DurationVar(&c.JWT.Leeway, "jwt-leeway", c.JWT.Leeway, "校验 exp 和 nbf 时允许的时钟误差")
+	fs.Var(&c.JWTGroups, "jwt-groups", "需要 JWT 认证的路由组，逗号分隔，可选 api,image")
+	fs.Var(&c.RedirectAllowedHosts, "redirect-allowed-hosts", "/redirect-to 允许跳转的域名，逗号分隔，支持 *.example.com")
+	fs.Var(&c.RedirectDeniedHosts, "redirect-denied-hosts", "/redirect-to 禁止跳转的域名，逗号分隔，支持 *.example.com")
+	fs.BoolVar(&c.RedirectRelativeOnly, "redirect-relative-only", c.RedirectRelativeOnly, "/redirect-to 只允许跳转到相对地址")
+	fs.Var(&c.TrustedProxies, "trusted-proxies", "可信代理的网段或 IP，逗号分隔，只信任它们发送的 Forwarded、X-Forwarded-* 和 X-Real-IP")
+	fs.StringVar(&c.TrustedProxyHeader, "trusted-proxy-header", c.TrustedProxyHeader, "可信代理写入客户端地址的头部，可选 X-Forwarded-For、Forwarded、X-Real-IP。为 Forwarded 时请求地址的协议和域名也从 Forwarded 读取，否则从 X-Forwarded-Proto 和 X-Forwarded-Host 读取，路径前缀总是从 X-Forwarded-Prefix 读取")
+
+	fs.StringVar(&c.TLSCert, "tls-cert", c.TLSCert, "TLS 证书文件，和 -tls-key 一起使用时开启 HTTPS")
+	fs.StringVar(&c.TLSKey, "tls-key", c.TLSKey, "TLS 私钥文件")
+	fs.StringVar(&c.TLSSelfSigned, "tls-self-signed", c.TLSSelfSigned, "自动生成自签名 CA 和证书的目录，已存在时直接使用，-tls-hosts 变化时用原来的 CA 重新签发证书，开启 HTTPS")
+	fs.Var(&c.TLSHosts, "tls-hosts", "自签名证书包含的域名和 IP，逗号分隔")
+	fs.BoolVar(&c.HTTP2, "http2", c.HTTP2, "HTTPS 时是否开启 HTTP/2")
+	fs.StringVar(&c.TLSClientAuth, "tls-client-auth", c.TLSClientAuth, "客户端证书校验方式，可选 none、request、require")
+	fs.StringVar(&c.TLSClientCA, "tls-client-ca", c.TLSClientCA, "校验客户端证书的 CA 文件，使用 -tls-self-signed 时默认为生成的 CA")
+}
+
+// loadConfig reads the settings from the config file, the environment and the
+// command line arguments, printConfig is true when -print-config is given.
+func loadConfig(fs *flag.FlagSet, args []string) (c *config, printConfig bool, err error) {
+	c = defaultConfig()
+	c.registerFlags(fs)
+
+	var configFile string
+	fs.StringVar(&configFile, configFlag, os.Getenv(envPrefix+"CONFIG"), "YAML 或 TOML 配置文件，也可以使用环境变量 HTTPBIN_CONFIG")
+	fs.BoolVar(&printConfig, printConfigFlag, false, "输出最终的配置后退出")
+
+	// 先解析一次命令行参数得到配置文件的路径
+	if err := fs.Parse(args); err != nil {
+		return nil, false, err
+	}
+
+	if configFile != "" {
+		if err := applyConfigFile(fs, configFile); err != nil {
+			return nil, false, err
+		}
+	}
+	if err := applyEnv(fs); err != nil {
+		return nil, false, err
+	}
+
+	// 命令行参数的优先级最高，再次解析覆盖配置文件和环境变量中的值
+	if err := fs.Parse(args); err != nil {
+		return nil, false, err
+	}
+
+	if err := c.validate(); err != nil {
+		return nil, false, err
+	}
+	return c, printConfig, nil
+}
+
+// validate checks the settings which are used as sizes and durations.
+func (c *config) validate() error {
+	limits := []struct {
+		name  string
+		value int64
+	}{
+		{"max-body-size", c.MaxBodySize},
+		{"max-bytes", c.MaxBytes},
+		{"max-stream-bytes", c.MaxStreamBytes},
+		{"read-timeout", int64(c.ReadTimeout)},
+		{"write-timeout", int64(c.WriteTimeout)},
+		{"idle-timeout", int64(c.IdleTimeout)},
+		{"shutdownTime", int64(c.ShutdownTime)},
+		{"jwt-leeway", int64(c.JWT.Leeway)},
+	}
+	for _, limit := range limits {
+		if limit.value < 0 {
+			return fmt.Errorf("-%s must not be negative", limit.name)
+		}
+	}
+	return nil
+}
+
+// envName returns the environment variable of a flag, e.g. HTTPBIN_SHUTDOWN_TIME for -shutdownTime.
+func envName(name string) string {
+	var b strings.Builder
+	b.WriteString(envPrefix)
+	for i, r := range name {
+		switch {
+		case r == '-':
+			b.WriteRune('_')
+		case unicode.IsUpper(r) && i > 0:
+			b.WriteRune('_')
+			b.WriteRune(r)
+		default:
+			b.WriteRune(unicode.ToUpper(r))
+		}
+	}
+	return b.String()
+}
+
+func applyEnv(fs *flag.FlagSet) error {
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || f.Name == configFlag || f.Name == printConfigFlag {
+			return
+		}
+		name := envName(f.Name)
+		if value, ok := os.LookupEnv(name); ok {
+			if setErr := fs.Set(f.Name, value); setErr != nil {
+				err = fmt.Errorf("invalid value %q for %s: %s", value, name, setErr)
+			}
+		}
+	})
+	return err
+}
+
+// applyConfigFile sets the flags from a flat YAML or TOML file, the format is
+// chosen by the file extension. Lists may be written as arrays.
+func applyConfigFile(fs *flag.FlagSet, filename string) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	settings := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".toml":
+		err = toml.Unmarshal(data, &settings)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &settings)
+	default:
+		err = errors.New("unsupported config file format, excepted .yaml, .yml or .toml")
+	}
+	if err != nil {
+		return fmt.Errorf("load config file %s: %s", filename, err)
+	}
+
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		name := key
+		if fs.Lookup(name) == nil {
+			// read_timeout 和 read-timeout 都可以使用
+			name = strings.Replace(key, "_", "-", -1)
+		}
+		if fs.Lookup(name) == nil || name == configFlag || name == printConfigFlag {
+			return fmt.Errorf("unknown setting %q in %s", key, filename)
+		}
+
+		value, err := settingString(settings[key])
+		if err != nil {
+			return fmt.Errorf("invalid value for %q in %s: %s", key, filename, err)
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("invalid value %q for %q in %s: %s", value, key, filename, err)
+		}
+	}
+
+	return nil
+}
+
+func settingString(value interface{}) (string, error) {
+	switch value := value.(type) {
+	case string:
+		return value, nil
+	case bool, int, int64, uint64, float64:
+		return fmt.Sprint(value), nil
+	case []interface{}:
+		items := make([]string, 0, len(value))
+		for _, item := range value {
+			s, err := settingString(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, s)
+		}
+		return strings.Join(items, ","), nil
+	default:
+		return "", fmt.Errorf("unsupported value type %T", value)
+	}
+}
+
+// writeConfig writes the settings as a YAML config file which can be loaded with -config.
+func writeConfig(w io.Writer, fs *flag.FlagSet) error {
+	var settings yaml.MapSlice
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == configFlag || f.Name == printConfigFlag {
+			return
+		}
+
+		var value interface{} = f.Value.String()
+		if getter, ok := f.Value.(flag.Getter); ok {
+			value = getter.Get()
+		}
+		if d, ok := value.(time.Duration); ok {
+			value = d.String()
+		}
+		settings = append(settings, yaml.MapItem{Key: f.Name, Value: value})
+	})
+
+	data, err := yaml.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEnvName(t *testing.T) {
+	cases := map[string]string{
+		"listen":           "HTTPBIN_LISTEN",
+		"read-timeout":     "HTTPBIN_READ_TIMEOUT",
+		"shutdownTime":     "HTTPBIN_SHUTDOWN_TIME",
+		"max-stream-bytes": "HTTPBIN_MAX_STREAM_BYTES",
+	}
+	for name, excepted := range cases {
+		if env := envName(name); env != excepted {
+			log.Fatalf("Unexcepted env name %s for %s, excepted %s\n", env, name, excepted)
+		}
+	}
+}
+
+func writeTempFile(dir, name, content string) string {
+	filename := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+		log.Fatalln(err)
+	}
+	return filename
+}
+
+func TestApplyConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpbin-config")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer os.RemoveAll(dir)
+
+	yamlConfig := "listen:\n  - 127.0.0.1:8080\n  - 127.0.0.1:8081\nread_timeout: 5s\nmax-bytes: 1024\nhttp2: false\n"
+	tomlConfig := "listen = [\"127.0.0.1:8080\", \"127.0.0.1:8081\"]\nread_timeout = \"5s\"\nmax-bytes = 1024\nhttp2 = false\n"
+	for name, content := range map[string]string{
+		"config.yaml": yamlConfig,
+		"config.yml":  yamlConfig,
+		"config.toml": tomlConfig,
+	} {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		c := defaultConfig()
+		c.registerFlags(fs)
+
+		if err := applyConfigFile(fs, writeTempFile(dir, name, content)); err != nil {
+			log.Fatalf("%s: %s\n", name, err)
+		}
+		if c.Listen.String() != "127.0.0.1:8080,127.0.0.1:8081" || c.ReadTimeout != 5*time.Second || c.MaxBytes != 1024 || c.HTTP2 {
+			log.Fatalf("%s: Unexcepted config %+v\n", name, c)
+		}
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	defaultConfig().registerFlags(fs)
+	if err := applyConfigFile(fs, writeTempFile(dir, "config.json", "{}")); err == nil {
+		log.Fatalln("Excepted error for unsupported config file format")
+	}
+	if err := applyConfigFile(fs, writeTempFile(dir, "unknown.yaml", "nope: 1\n")); err == nil {
+		log.Fatalln("Excepted error for unknown setting")
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpbin-config")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer os.RemoveAll(dir)
+	configFile := writeTempFile(dir, "config.yaml", "read-timeout: 1s\nwrite-timeout: 1s\nidle-timeout: 1s\n")
+
+	// 优先级：配置文件 < 环境变量 < 命令行参数
+	os.Setenv("HTTPBIN_WRITE_TIMEOUT", "2s")
+	os.Setenv("HTTPBIN_IDLE_TIMEOUT", "2s")
+	defer os.Unsetenv("HTTPBIN_WRITE_TIMEOUT")
+	defer os.Unsetenv("HTTPBIN_IDLE_TIMEOUT")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	c, printConfig, err := loadConfig(fs, []string{"-config", configFile, "-idle-timeout", "3s", "-print-config"})
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if c.ReadTimeout != time.Second || c.WriteTimeout != 2*time.Second || c.IdleTimeout != 3*time.Second || !printConfig {
+		log.Fatalf("Unexcepted timeouts %s %s %s\n", c.ReadTimeout, c.WriteTimeout, c.IdleTimeout)
+	}
+
+	for _, args := range [][]string{
+		{"-max-bytes", "-1"},
+		{"-max-stream-bytes", "-1"},
+		{"-read-timeout", "-1s"},
+	} {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		if _, _, err := loadConfig(fs, args); err == nil {
+			log.Fatalf("Excepted error for %v\n", args)
+		}
+	}
+}
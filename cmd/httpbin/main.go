@@ -2,54 +2,212 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"flag"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
-	"time"
+	"path/filepath"
+	"sync"
 
 	"github.com/bwangelme/go-httpbin"
+	"github.com/bwangelme/go-httpbin/middlewares"
 	"github.com/gorilla/handlers"
 )
 
 func main() {
-	var router = httpbin.GetMux()
-	handler := handlers.LoggingHandler(os.Stdout, router)
+	cfg, printOnly, err := loadConfig(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if printOnly {
+		if err := writeConfig(os.Stdout, flag.CommandLine); err != nil {
+			log.Fatalln(err)
+		}
+		os.Exit(0)
+	}
+
+	if cfg.LogFile != "" {
+		logFile, err := os.OpenFile(cfg.LogFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		defer logFile.Close()
+		log.SetOutput(logFile)
+		httpbin.SetLogOutput(logFile)
+	}
+
+	if len(cfg.Listen) == 0 {
+		log.Fatalln("-listen requires at least one address")
+	}
+
+	tlsCert, tlsKey, tlsClientCA := cfg.TLSCert, cfg.TLSKey, cfg.TLSClientCA
+	if (tlsCert == "") != (tlsKey == "") {
+		log.Fatalln("-tls-cert and -tls-key must be given together")
+	}
+	if cfg.TLSSelfSigned != "" {
+		if tlsCert != "" {
+			log.Fatalln("-tls-self-signed can't be used with -tls-cert")
+		}
+		tlsCert, tlsKey, err = selfSignedCertificate(cfg.TLSSelfSigned, cfg.TLSHosts)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if tlsClientCA == "" {
+			tlsClientCA = filepath.Join(cfg.TLSSelfSigned, caCertFile)
+		}
+	}
+
+	clientAuth, ok := clientAuthTypes[cfg.TLSClientAuth]
+	if !ok {
+		log.Fatalf("Invalid -tls-client-auth %q, excepted none, request or require\n", cfg.TLSClientAuth)
+	}
+	if clientAuth != tls.NoClientCert && tlsCert == "" {
+		log.Fatalln("-tls-client-auth requires HTTPS")
+	}
+
+	httpbin.MAX_BODY_SIZE = cfg.MaxBodySize
+	httpbin.MAX_BYTES = cfg.MaxBytes
+	httpbin.MAX_STREAM_BYTES = cfg.MaxStreamBytes
+	httpbin.TEMPLATE_DIR = cfg.TemplateDir
+	httpbin.STATIC_DIR = cfg.StaticDir
+
+	groups, err := httpbin.ParseGroups(cfg.Groups)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	httpbin.ENABLED_GROUPS = groups
+
+	httpbin.REDIRECT_POLICY = httpbin.RedirectPolicy{
+		RelativeOnly: cfg.RedirectRelativeOnly,
+		AllowedHosts: cfg.RedirectAllowedHosts,
+		DeniedHosts:  cfg.RedirectDeniedHosts,
+	}
+
+	networks, err := httpbin.ParseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	clientHeader, err := httpbin.ParseProxyHeader(cfg.TrustedProxyHeader)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	httpbin.PROXY_POLICY = httpbin.ProxyPolicy{
+		TrustedProxies: networks,
+		ClientHeader:   clientHeader,
+	}
 
-	var wait time.Duration
-	flag.DurationVar(&wait, "shutdownTime", 15*time.Second, "服务器被关闭时的等待时间")
-	flag.Parse()
+	if cfg.JWT.KeyFile != "" || cfg.JWT.SecretFile != "" {
+		jwtm, err := middlewares.NewJWTMiddleware(cfg.JWT)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		httpbin.JWT_MIDDLEWARE = jwtm
+		httpbin.JWT_GROUPS = cfg.JWTGroups
+	}
+
+	var router = httpbin.GetMux()
+	handler, closeAccessLog := accessLogHandler(cfg, router)
+	defer closeAccessLog()
 
 	srv := &http.Server{
-		Addr:         "localhost:8080",
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  30 * time.Second,
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		IdleTimeout:  cfg.IdleTimeout,
 		Handler:      handler,
 	}
 
-	c := make(chan os.Signal)
-	go func() {
-		log.Println("Start server on", srv.Addr)
-		if err := srv.ListenAndServe(); err != nil {
-			if err == http.ErrServerClosed {
-				log.Println("Graceful shutdown the server")
-				c <- os.Interrupt
-			} else {
+	if tlsCert != "" {
+		srv.TLSConfig = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			NextProtos: []string{"h2", "http/1.1"},
+			ClientAuth: clientAuth,
+		}
+		if clientAuth != tls.NoClientCert {
+			pool, err := loadCertPool(tlsClientCA)
+			if err != nil {
 				log.Fatalln(err)
 			}
+			srv.TLSConfig.ClientCAs = pool
 		}
-	}()
+		if !cfg.HTTP2 {
+			// TLSNextProto 不为 nil 时 net/http 不会开启 HTTP/2
+			srv.TLSConfig.NextProtos = []string{"http/1.1"}
+			srv.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+		}
+	}
+
+	// 先监听所有地址，任何一个地址不可用时直接退出
+	var listeners []net.Listener
+	for _, addr := range cfg.Listen {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		listeners = append(listeners, ln)
+	}
+
+	var wg sync.WaitGroup
+	for _, ln := range listeners {
+		wg.Add(1)
+		go func(ln net.Listener) {
+			defer wg.Done()
 
+			var err error
+			if tlsCert != "" {
+				log.Println("Start server on https://" + ln.Addr().String())
+				err = srv.ServeTLS(ln, tlsCert, tlsKey)
+			} else {
+				log.Println("Start server on http://" + ln.Addr().String())
+				err = srv.Serve(ln)
+			}
+			if err != http.ErrServerClosed {
+				log.Fatalln(err)
+			}
+		}(ln)
+	}
+
+	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
 	<-c
 
-	ctx, cancel := context.WithTimeout(context.Background(), wait)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTime)
 	defer cancel()
 
 	srv.Shutdown(ctx)
-	<-c
+	wg.Wait()
+	log.Println("Graceful shutdown the server")
+}
+
+// accessLogHandler wraps handler with the access log configured by -access-log
+// and -access-log-format, the returned function closes the log file.
+func accessLogHandler(cfg *config, handler http.Handler) (http.Handler, func()) {
+	var out io.Writer
+	closeLog := func() {}
+
+	switch cfg.AccessLog {
+	case "", "off":
+		return handler, closeLog
+	case "-":
+		out = os.Stdout
+	default:
+		file, err := os.OpenFile(cfg.AccessLog, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		out, closeLog = file, func() { file.Close() }
+	}
 
-	os.Exit(0)
+	switch cfg.AccessLogFormat {
+	case "common":
+		handler = handlers.LoggingHandler(out, handler)
+	case "combined":
+		handler = handlers.CombinedLoggingHandler(out, handler)
+	default:
+		log.Fatalf("Invalid -access-log-format %q, excepted common or combined\n", cfg.AccessLogFormat)
+	}
+	return handler, closeLog
 }
@@ -1,5 +1,10 @@
 package httpbin
 
+import (
+	"fmt"
+	"strings"
+)
+
 type UrlItem struct {
 	Method string
 	Name   string
@@ -12,9 +17,14 @@ var URL_GROUP_CONFIG = []string{
 	"HTTP Methods",
 	"Auth",
 	"Status Code",
+	"Redirects",
+	"Cookies",
 	"Images",
 	"Request inspection",
+	"Response inspection",
 	"Dynamic data",
+	"Response formats",
+	"Anything",
 }
 
 var URL_CONFIG = map[string][]UrlItem{
@@ -22,21 +32,35 @@ var URL_CONFIG = map[string][]UrlItem{
 		UrlItem{"GET", "/", "/", ""},
 	},
 	"HTTP Methods": {
-		UrlItem{"GET", "- /delete", "#", "Returns GET data."},
+		UrlItem{"DELETE", "/delete", "#", "Returns DELETE data."},
 		UrlItem{"GET", "/get", "/get", "Returns GET data."},
-		UrlItem{"GET", "- /patch", "#", "Returns GET data."},
-		UrlItem{"GET", "- /post", "#", "Returns GET data."},
-		UrlItem{"GET", "- /put", "#", "Returns GET data."},
+		UrlItem{"PATCH", "/patch", "#", "Returns PATCH data."},
+		UrlItem{"POST", "/post", "#", "Returns POST data."},
+		UrlItem{"PUT", "/put", "#", "Returns PUT data."},
 	},
 	"Auth": {
 		UrlItem{"GET", "/basic-auth/{user}/{passwd}", "/basic-auth/user/passwd", "Challenges HTTPBasic Auth"},
-		UrlItem{"GET", "- /bearer", "#", "Challenges HTTPBasic Auth"},
-		UrlItem{"GET", "- /digest-auth/{qop}/{user}/{passwd}", "#", "Challenges HTTPBasic Auth"},
-		UrlItem{"GET", "- /digest-auth/{qop}/{user}/{passwd}/{algorithm}", "#", "Challenges HTTPBasic Auth"},
-		UrlItem{"GET", "- /hidden-basic-auth/{user}/{passwd}", "#", "Challenges HTTPBasic Auth"},
+		UrlItem{"GET", "/bearer", "/bearer", "Prompts the user for authorization using bearer authentication."},
+		UrlItem{"GET", "/digest-auth/{qop}/{user}/{passwd}", "/digest-auth/auth/user/passwd", "Challenges HTTP Digest Auth."},
+		UrlItem{"GET", "/digest-auth/{qop}/{user}/{passwd}/{algorithm}", "/digest-auth/auth/user/passwd/SHA-256", "Challenges HTTP Digest Auth, <em>algorithm</em> is one of MD5, SHA-256 and SHA-512-256."},
+		UrlItem{"GET", "/digest-auth/{qop}/{user}/{passwd}/{algorithm}/{stale_after}", "/digest-auth/auth/user/passwd/MD5/never", "Challenges HTTP Digest Auth, the nonce becomes stale after <em>stale_after</em> requests."},
+		UrlItem{"GET", "/hidden-basic-auth/{user}/{passwd}", "/hidden-basic-auth/user/passwd", "404'd BasicAuth."},
 	},
 	"Status Code": {
-		UrlItem{"GET", "- /status/{code}", "#", ""},
+		UrlItem{"*", "/status/{codes}", "/status/418", "Return status code or random status code if more than one are given, codes may be weighted like <em>200:0.7,500:0.3</em>."},
+	},
+	"Redirects": {
+		UrlItem{"GET", "/redirect/{n}", "/redirect/6", "302 Redirects <em>n</em> times, pass <em>absolute=true</em> for absolute Location headers."},
+		UrlItem{"GET", "/redirect-to?url=foo", "/redirect-to?url=/get", "3XX Redirects to the <em>foo</em> URL, <em>status_code</em> may be 301, 302, 303, 307 or 308."},
+		UrlItem{"GET", "/redirect-to?url=foo&status_code=307", "/redirect-to?url=/get&status_code=307", "307 Redirects to the <em>foo</em> URL."},
+		UrlItem{"GET", "/relative-redirect/{n}", "/relative-redirect/6", "302 Relative redirects <em>n</em> times."},
+		UrlItem{"GET", "/absolute-redirect/{n}", "/absolute-redirect/6", "302 Absolute redirects <em>n</em> times."},
+	},
+	"Cookies": {
+		UrlItem{"GET", "/cookies", "/cookies", "Returns cookie data."},
+		UrlItem{"GET", "/cookies/set?name=value", "/cookies/set?k1=v1&k2=v2", "Sets one or more simple cookies. <em>secure</em>, <em>httponly</em>, <em>samesite</em>, <em>path</em>, <em>domain</em> and <em>max_age</em> set cookie attributes."},
+		UrlItem{"GET", "/cookies/set/{name}/{value}", "/cookies/set/k1/v1", "Sets a simple cookie."},
+		UrlItem{"GET", "/cookies/delete?name", "/cookies/delete?k1&k2", "Deletes one or more simple cookies."},
 	},
 	"Images": {
 		UrlItem{"GET", "/image", "/image", "Returns page containing an image based on sent Accept header."},
@@ -49,11 +73,115 @@ var URL_CONFIG = map[string][]UrlItem{
 		UrlItem{"GET", "/ip", "/ip", "Returns Origin IP."},
 		UrlItem{"GET", "/user-agent", "/user-agent", "Returns user-agent."},
 		UrlItem{"GET", "/headers", "/headers", "Returns header dict."},
+		UrlItem{"GET", "/tls", "/tls", "Returns the TLS connection parameters and the client certificates."},
+	},
+	"Response inspection": {
+		UrlItem{"GET", "/cache", "/cache", "Returns a 304 if an If-Modified-Since header or If-None-Match is present. Returns the same as a GET otherwise."},
+		UrlItem{"GET", "/cache/{n}", "/cache/60", "Sets a Cache-Control header for <em>n</em> seconds."},
+		UrlItem{"GET", "/response-headers?key=val", "/response-headers?Content-Type=text/plain;%20charset=UTF-8&Server=httpbin", "Returns given response headers."},
+		UrlItem{"GET", "/etag/{etag}", "/etag/etag", "Assumes the resource has the given etag and responds to If-None-Match and If-Match headers appropriately."},
 	},
 	"Dynamic data": {
 		UrlItem{"GET", "/base64/{value}", "/base64/aGVsbG8gd29ybGQNCg==", "Decodes base64url-encoded string."},
 		UrlItem{"GET", "/bytes/{n}", "/bytes/1024", "Generates <em>n</em> random bytes of binary data, accepts optional <em>seed</em> integer parameter."},
+		UrlItem{"GET", "/links/{n}/{offset}", "/links/10/0", "Generate a page containing <em>n</em> links to other pages which do the same."},
+		UrlItem{"GET", "/range/{numbytes}", "/range/1024", "Streams <em>n</em> bytes, and allows specifying a <em>Range</em> header to select a subset of the data. Accepts a <em>chunk_size</em> and request <em>duration</em> parameter."},
+		UrlItem{"GET", "/stream/{n}", "/stream/20", "Streams <em>min(n, 100)</em> lines of JSON objects."},
 		UrlItem{"GET", "/stream-bytes/{n}", "/stream-bytes/20925?filename=data.bin", "Streams <em>n</em> random bytes of binary data in chunked encoding, accepts optional <em>seed</em>, <em>filename</em> and <em>chunk_size</em> integer parameters."},
 		UrlItem{"GET", "/uuid", "/uuid", "Returns UUID4."},
+		UrlItem{"*", "/delay/{n}", "/delay/3", "Returns a delayed response (max of 10 seconds)."},
+		UrlItem{"GET", "/drip", "/drip?duration=5&numbytes=5&code=200&delay=2", "Drips data over a duration after an optional initial delay, then (optionally) returns with the given status code."},
+	},
+	"Response formats": {
+		UrlItem{"GET", "/brotli", "/brotli", "Returns Brotli-encoded data."},
+		UrlItem{"GET", "/deflate", "/deflate", "Returns Deflate-encoded data."},
+		UrlItem{"GET", "/deny", "/deny", "Returns page denied by robots.txt rules."},
+		UrlItem{"GET", "/encoding/utf8", "/encoding/utf8", "Returns a UTF-8 encoded body."},
+		UrlItem{"GET", "/gzip", "/gzip", "Returns GZip-encoded data."},
+		UrlItem{"GET", "/html", "/html", "Returns a simple HTML document."},
+		UrlItem{"GET", "/json", "/json", "Returns a simple JSON document."},
+		UrlItem{"GET", "/robots.txt", "/robots.txt", "Returns some robots.txt rules."},
+		UrlItem{"GET", "/xml", "/xml", "Returns a simple XML document."},
 	},
+	"Anything": {
+		UrlItem{"*", "/anything", "/anything", "Returns anything passed in request data, accepts every method."},
+		UrlItem{"*", "/anything/{anything}", "/anything/foo/bar", "Returns anything passed in request data, accepts every method and subpath."},
+	},
+}
+
+// ParseGroups returns the names in URL_GROUP_CONFIG matching names, the
+// comparison ignores case and treats "-" and "_" as spaces, so "http-methods"
+// matches "HTTP Methods".
+func ParseGroups(names []string) ([]string, error) {
+	normalize := func(name string) string {
+		name = strings.NewReplacer("-", " ", "_", " ").Replace(name)
+		return strings.ToLower(strings.TrimSpace(name))
+	}
+
+	var groups []string
+	for _, name := range names {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+
+		found := false
+		for _, group := range URL_GROUP_CONFIG {
+			if normalize(group) == normalize(name) {
+				groups = append(groups, group)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown endpoint group %q, excepted one of %s", name, strings.Join(URL_GROUP_CONFIG, ", "))
+		}
+	}
+
+	return groups, nil
+}
+
+// groupOf returns the group of the URL_CONFIG item whose first path segment is
+// the same as path, "" when path doesn't belong to any group.
+func groupOf(path string) string {
+	segment := func(path string) string {
+		path = strings.TrimPrefix(path, "/")
+		if i := strings.IndexAny(path, "/?"); i >= 0 {
+			path = path[:i]
+		}
+		return path
+	}
+
+	for group, items := range URL_CONFIG {
+		for _, item := range items {
+			if segment(item.Name) == segment(path) {
+				return group
+			}
+		}
+	}
+	return ""
+}
+
+// groupEnabled reports whether the endpoints of group are served, the index
+// page and the endpoints without a group are always served.
+func groupEnabled(group string) bool {
+	if len(ENABLED_GROUPS) == 0 || group == "" || group == "This Page" {
+		return true
+	}
+	for _, enabled := range ENABLED_GROUPS {
+		if enabled == group {
+			return true
+		}
+	}
+	return false
+}
+
+// enabledGroups returns URL_GROUP_CONFIG without the disabled groups.
+func enabledGroups() []string {
+	var groups []string
+	for _, group := range URL_GROUP_CONFIG {
+		if groupEnabled(group) {
+			groups = append(groups, group)
+		}
+	}
+	return groups
 }
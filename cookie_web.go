@@ -0,0 +1,148 @@
+package httpbin
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// cookieOptionKeys 是 /cookies/set 和 /cookies/delete 中用来设置 cookie 属性的参数，
+// 它们不会被当作 cookie 设置
+var cookieOptionKeys = map[string]bool{
+	"secure":   true,
+	"httponly": true,
+	"samesite": true,
+	"path":     true,
+	"domain":   true,
+	"max_age":  true,
+}
+
+var sameSiteModes = map[string]http.SameSite{
+	"lax":    http.SameSiteLaxMode,
+	"strict": http.SameSiteStrictMode,
+	"none":   http.SameSiteNoneMode,
+}
+
+// newCookie returns a cookie with the attributes given by the option parameters.
+func newCookie(r *http.Request, name, value string) (*http.Cookie, error) {
+	cookie := &http.Cookie{
+		Name:  name,
+		Value: value,
+		Path:  "/",
+	}
+
+	if path := r.FormValue("path"); path != "" {
+		cookie.Path = path
+	}
+	cookie.Domain = r.FormValue("domain")
+
+	for _, key := range []string{"secure", "httponly"} {
+		raw := r.FormValue(key)
+		if raw == "" {
+			continue
+		}
+		enabled, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s %s", key, raw)
+		}
+		if key == "secure" {
+			cookie.Secure = enabled
+		} else {
+			cookie.HttpOnly = enabled
+		}
+	}
+
+	if sameSiteRaw := r.FormValue("samesite"); sameSiteRaw != "" {
+		sameSite, ok := sameSiteModes[strings.ToLower(sameSiteRaw)]
+		if !ok {
+			return nil, fmt.Errorf("Invalid samesite %s, excepted one of Lax, Strict, None", sameSiteRaw)
+		}
+		cookie.SameSite = sameSite
+	}
+
+	if maxAgeRaw := r.FormValue("max_age"); maxAgeRaw != "" {
+		maxAge, err := strconv.Atoi(maxAgeRaw)
+		if err != nil || maxAge < 0 {
+			return nil, fmt.Errorf("Invalid max_age %s", maxAgeRaw)
+		}
+		cookie.MaxAge = maxAge
+		cookie.Expires = time.Now().Add(time.Duration(maxAge) * time.Second).UTC()
+	}
+
+	return cookie, nil
+}
+
+func setCookiesAndRedirect(w http.ResponseWriter, r *http.Request, cookies map[string]string) {
+	for name, value := range cookies {
+		cookie, err := newCookie(r, name, value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		http.SetCookie(w, cookie)
+	}
+
+	w.Header().Set("Location", "/cookies")
+	w.WriteHeader(http.StatusFound)
+}
+
+// CookiesHandler returns the cookies sent by the client.
+func CookiesHandler(w http.ResponseWriter, r *http.Request) {
+	cookies := make(map[string]string)
+	for _, cookie := range r.Cookies() {
+		cookies[cookie.Name] = cookie.Value
+	}
+
+	writeResult(w, r, map[string]interface{}{
+		"cookies": cookies,
+	})
+}
+
+// SetCookiesHandler sets the cookies given in the query string and redirects to /cookies.
+func SetCookiesHandler(w http.ResponseWriter, r *http.Request) {
+	cookies := make(map[string]string)
+	for name, values := range r.URL.Query() {
+		if cookieOptionKeys[name] {
+			continue
+		}
+		cookies[name] = values[0]
+	}
+
+	setCookiesAndRedirect(w, r, cookies)
+}
+
+// SetCookieHandler sets the cookie given in the path and redirects to /cookies.
+func SetCookieHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars == nil {
+		logger.Println("INVALID PATH")
+		return
+	}
+
+	setCookiesAndRedirect(w, r, map[string]string{vars["name"]: vars["value"]})
+}
+
+// DeleteCookiesHandler expires the cookies named in the query string and redirects to /cookies.
+func DeleteCookiesHandler(w http.ResponseWriter, r *http.Request) {
+	for name := range r.URL.Query() {
+		if cookieOptionKeys[name] {
+			continue
+		}
+
+		cookie, err := newCookie(r, name, "")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		cookie.MaxAge = -1
+		cookie.Expires = time.Unix(0, 0).UTC()
+		http.SetCookie(w, cookie)
+	}
+
+	w.Header().Set("Location", "/cookies")
+	w.WriteHeader(http.StatusFound)
+}
@@ -0,0 +1,175 @@
+package httpbin
+
+/*
+ * HTTP Digest Access Authentication, RFC 7616
+ */
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const digestRealm = "go-httpbin"
+
+var digestAlgorithms = map[string]func() hash.Hash{
+	"MD5":         md5.New,
+	"SHA-256":     sha256.New,
+	"SHA-512-256": sha512.New512_256,
+}
+
+func digestHex(algorithm string, data string) string {
+	h := digestAlgorithms[algorithm]()
+	h.Write([]byte(data))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		logger.Fatalln(err)
+	}
+	return hex.EncodeToString(buf)
+}
+
+// digestChallenge builds the value of the WWW-Authenticate header, an empty
+// qop means the RFC 2069 compatible challenge without qop.
+func digestChallenge(qop string, algorithm string, stale bool) string {
+	params := []string{
+		fmt.Sprintf(`realm="%s"`, digestRealm),
+		fmt.Sprintf(`nonce="%s"`, randomHex(16)),
+		fmt.Sprintf(`opaque="%s"`, randomHex(16)),
+		fmt.Sprintf("algorithm=%s", algorithm),
+		fmt.Sprintf("stale=%s", strings.ToUpper(strconv.FormatBool(stale))),
+	}
+	if qop != "" {
+		params = append(params, fmt.Sprintf(`qop="%s"`, qop))
+	}
+
+	return "Digest " + strings.Join(params, ", ")
+}
+
+// parseDigestAuthorization parses the parameters of a "Digest" Authorization
+// header, values may be tokens or quoted strings.
+func parseDigestAuthorization(header string) (map[string]string, bool) {
+	const prefix = "digest "
+	if len(header) < len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return nil, false
+	}
+
+	params := make(map[string]string)
+	s := header[len(prefix):]
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			break
+		}
+
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 {
+			return nil, false
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = strings.TrimLeft(s[eq+1:], " \t")
+
+		var value strings.Builder
+		if strings.HasPrefix(s, `"`) {
+			i := 1
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				value.WriteByte(s[i])
+			}
+			if i >= len(s) {
+				return nil, false
+			}
+			s = s[i+1:]
+		} else {
+			end := strings.IndexByte(s, ',')
+			if end < 0 {
+				end = len(s)
+			}
+			value.WriteString(strings.TrimSpace(s[:end]))
+			s = s[end:]
+		}
+		params[key] = value.String()
+	}
+
+	return params, true
+}
+
+// checkDigestAuth verifies the response sent by the client for the given
+// user, password, qop and algorithm. The response must be computed for the
+// realm of the challenge and the URI of this request, with or without the
+// prefix removed by a trusted proxy. The error is returned when the body of an
+// auth-int request can't be read.
+func checkDigestAuth(r *http.Request, credentials map[string]string, user, passwd, qop, algorithm string) (bool, error) {
+	if credentials["username"] != user {
+		return false, nil
+	}
+	if credentials["qop"] != qop {
+		return false, nil
+	}
+	clientAlgorithm := credentials["algorithm"]
+	if clientAlgorithm == "" {
+		clientAlgorithm = "MD5"
+	}
+	if !strings.EqualFold(clientAlgorithm, algorithm) {
+		return false, nil
+	}
+
+	// 不使用客户端发送的 realm 和 uri，否则为一个地址计算的响应可以用于其他地址。
+	// 去掉了 X-Forwarded-Prefix 的可信代理后面，客户端使用的是带前缀的地址
+	uris := []string{r.URL.RequestURI()}
+	if _, _, prefix := PROXY_POLICY.ForwardedURL(r); prefix != "" {
+		uris = append(uris, prefix+r.URL.RequestURI())
+	}
+	ha1 := digestHex(algorithm, fmt.Sprintf("%s:%s:%s", user, digestRealm, passwd))
+
+	var body []byte
+	if qop == "auth-int" {
+		var err error
+		if body, err = readBody(r); err != nil {
+			return false, err
+		}
+	}
+
+	for _, uri := range uris {
+		ha2 := digestHex(algorithm, fmt.Sprintf("%s:%s", r.Method, uri))
+		if qop == "auth-int" {
+			ha2 = digestHex(algorithm, fmt.Sprintf("%s:%s:%s", r.Method, uri, digestHex(algorithm, string(body))))
+		}
+
+		var expected string
+		if qop == "" {
+			expected = digestHex(algorithm, fmt.Sprintf("%s:%s:%s", ha1, credentials["nonce"], ha2))
+		} else {
+			expected = digestHex(algorithm, fmt.Sprintf("%s:%s:%s:%s:%s:%s",
+				ha1, credentials["nonce"], credentials["nc"], credentials["cnonce"], qop, ha2))
+		}
+
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(credentials["response"])) == 1 {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// nextStaleAfter decreases the stale_after counter stored in the cookie.
+func nextStaleAfter(value string) string {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return "never"
+	}
+	return strconv.Itoa(n - 1)
+}
@@ -0,0 +1,46 @@
+package httpbin
+
+import (
+	"net/http"
+	"path/filepath"
+)
+
+func writeResource(w http.ResponseWriter, filename string, contentType string) {
+	data, err := Resource(filepath.Join("samples", filename))
+	if err != nil {
+		logger.InternalErrorPrint(w, err)
+		return
+	}
+
+	writeBody(w, http.StatusOK, contentType, data)
+}
+
+// HTMLHandler returns a simple HTML document.
+func HTMLHandler(w http.ResponseWriter, r *http.Request) {
+	writeResource(w, "moby.html", "text/html; charset=utf-8")
+}
+
+// XMLHandler returns a simple XML document.
+func XMLHandler(w http.ResponseWriter, r *http.Request) {
+	writeResource(w, "sample.xml", "application/xml")
+}
+
+// JSONHandler returns a simple JSON document.
+func JSONHandler(w http.ResponseWriter, r *http.Request) {
+	writeResource(w, "sample.json", "application/json")
+}
+
+// RobotsHandler returns some robots.txt rules.
+func RobotsHandler(w http.ResponseWriter, r *http.Request) {
+	writeResource(w, "robots.txt", "text/plain; charset=utf-8")
+}
+
+// DenyHandler returns a page denied by robots.txt rules.
+func DenyHandler(w http.ResponseWriter, r *http.Request) {
+	writeResource(w, "deny.txt", "text/plain; charset=utf-8")
+}
+
+// UTF8Handler returns a UTF-8 encoded body.
+func UTF8Handler(w http.ResponseWriter, r *http.Request) {
+	writeResource(w, "UTF-8-demo.txt", "text/html; charset=utf-8")
+}
@@ -1,13 +1,17 @@
 module github.com/bwangelme/go-httpbin
 
 require (
+	github.com/BurntSushi/toml v0.3.1
+	github.com/andybalholm/brotli v1.0.6
 	github.com/google/uuid v1.0.0
 	github.com/gorilla/handlers v1.4.0
-	github.com/gorilla/mux v1.6.2
+	github.com/gorilla/mux v1.7.4
 	github.com/hoisie/web v0.1.1-0.20160809141353-a498c022b2c0
+	github.com/vmihailenco/msgpack/v5 v5.3.5
 	golang.org/x/crypto v0.0.0-20181009213950-7c1a557ab941 // indirect
 	golang.org/x/net v0.0.0-20181011144130-49bb7cea24b1 // indirect
 	golang.org/x/sys v0.0.0-20181011152604-fa43e7bc11ba // indirect
+	gopkg.in/yaml.v2 v2.3.0
 )
 
 go 1.13
@@ -5,17 +5,34 @@ package httpbin
  */
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"mime"
+	"mime/multipart"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 )
 
+// multipart 表单在内存中保存的最大字节数，超出部分写入临时文件
+const maxMultipartMemory = 32 << 20
+
+var errBodyTooLarge = errors.New("Request body is too large")
+
 func checkBasicAuth(r *http.Request, user string, passwd string) bool {
 	User, Passwd, ok := r.BasicAuth()
-	fmt.Println(User, Passwd, ok)
 	if !ok {
 		return false
 	}
@@ -23,28 +40,34 @@ func checkBasicAuth(r *http.Request, user string, passwd string) bool {
 	return (User == user && Passwd == passwd)
 }
 
-func getHeadersMap(header http.Header) map[string]string {
-	headers := make(map[string]string)
-
-	for k, v := range header {
-		if len(v) > 0 {
-			headers[k] = v[0]
-		}
+// checkBearerAuth returns the token of the "Authorization: Bearer <token>" header.
+func checkBearerAuth(r *http.Request) (string, bool) {
+	const prefix = "bearer "
+	auth := r.Header.Get("Authorization")
+	if len(auth) <= len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return "", false
 	}
 
-	return headers
+	token := strings.TrimSpace(auth[len(prefix):])
+	return token, token != ""
 }
 
-func getPeerIP(r *http.Request) string {
-	ip := r.Header.Get("X-Forwarded-For")
-	if len(ip) == 0 {
-		ip = r.RemoteAddr
-	}
+func getHeadersMap(header http.Header) map[string]interface{} {
+	return flattenValues(header)
+}
 
-	return ip
+// getPeerIP returns the client address, resolved through PROXY_POLICY.
+func getPeerIP(r *http.Request) string {
+	return PROXY_POLICY.ClientIP(r)
 }
 
+// getRequestScheme returns the scheme the client used, which is reported by
+// trusted proxies when TLS is terminated in front of us.
 func getRequestScheme(r *http.Request) string {
+	if scheme, _, _ := PROXY_POLICY.ForwardedURL(r); scheme != "" {
+		return scheme
+	}
+
 	if r.TLS != nil {
 		return "https"
 	} else {
@@ -52,9 +75,21 @@ func getRequestScheme(r *http.Request) string {
 	}
 }
 
+// getBaseURL returns the scheme and host the request was sent to, e.g. "http://localhost:8080".
+// Behind a trusted proxy the forwarded host and path prefix are used, e.g.
+// "https://example.com/httpbin".
+func getBaseURL(r *http.Request) string {
+	_, host, prefix := PROXY_POLICY.ForwardedURL(r)
+	if host == "" {
+		host = r.Host
+	}
+
+	return fmt.Sprintf("%s://%s%s", getRequestScheme(r), host, prefix)
+}
+
 func Resource(filename string) (data []byte, err error) {
 	if !filepath.IsAbs(filename) {
-		filename = filepath.Join("static", filename)
+		filename = filepath.Join(STATIC_DIR, filename)
 	}
 
 	fd, err := os.Open(filename)
@@ -78,16 +113,382 @@ func Resource(filename string) (data []byte, err error) {
 	}
 }
 
-func getQueryArgs(r *http.Request) (map[string]string, error) {
-	queryArgs := make(map[string]string)
+func getQueryArgs(r *http.Request) (map[string]interface{}, error) {
 	values, err := url.ParseQuery(r.URL.RawQuery)
 	if err != nil {
-		return queryArgs, err
+		return make(map[string]interface{}), err
+	}
+
+	return flattenValues(values), nil
+}
+
+// flattenValues converts multi-valued maps such as url.Values and http.Header
+// into a JSON friendly map. Keys with a single value map to a string, keys
+// with several values keep all of them as a list.
+func flattenValues(values map[string][]string) map[string]interface{} {
+	result := make(map[string]interface{})
+
+	for k, v := range values {
+		switch len(v) {
+		case 0:
+		case 1:
+			result[k] = v[0]
+		default:
+			result[k] = v
+		}
+	}
+
+	return result
+}
+
+// requestBody holds the parsed body of a POST, PUT or PATCH request.
+type requestBody struct {
+	form  url.Values
+	files url.Values
+	data  string
+	json  interface{}
+}
+
+// readBody reads the whole request body, at most MAX_BODY_SIZE bytes, and
+// restores it so it can be read again.
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+
+	reader := r.Body
+	if MAX_BODY_SIZE > 0 {
+		reader = ioutil.NopCloser(io.LimitReader(r.Body, MAX_BODY_SIZE+1))
+	}
+	raw, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	if MAX_BODY_SIZE > 0 && int64(len(raw)) > MAX_BODY_SIZE {
+		return nil, errBodyTooLarge
+	}
+	r.Body.Close()
+	r.Body = ioutil.NopCloser(bytes.NewReader(raw))
+
+	return raw, nil
+}
+
+// parseRequestBody reads the whole request body and decodes it according to
+// its Content-Type, the same way Python httpbin fills form, files, data and json.
+// The body is restored afterwards so it can be read again.
+func parseRequestBody(r *http.Request) (*requestBody, error) {
+	body := &requestBody{
+		form:  make(url.Values),
+		files: make(url.Values),
+	}
+	if r.Body == nil {
+		return body, nil
+	}
+
+	raw, err := readBody(r)
+	if err != nil {
+		return nil, err
+	}
+
+	mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		form, err := url.ParseQuery(string(raw))
+		if err != nil {
+			return nil, err
+		}
+		body.form = form
+	case "multipart/form-data":
+		reader := multipart.NewReader(bytes.NewReader(raw), params["boundary"])
+		form, err := reader.ReadForm(maxMultipartMemory)
+		if err != nil {
+			return nil, err
+		}
+		defer form.RemoveAll()
+
+		for k, v := range form.Value {
+			body.form[k] = v
+		}
+		for k, fileHeaders := range form.File {
+			for _, fh := range fileHeaders {
+				content, err := readMultipartFile(fh)
+				if err != nil {
+					return nil, err
+				}
+				body.files.Add(k, content)
+			}
+		}
+	default:
+		body.data = encodeBodyData(raw, "application/octet-stream")
+		if len(raw) > 0 {
+			// 和 py 版本一致，无法解析的 JSON 返回 null
+			if err := json.Unmarshal(raw, &body.json); err != nil {
+				body.json = nil
+			}
+		}
+	}
+
+	return body, nil
+}
+
+func readMultipartFile(fh *multipart.FileHeader) (string, error) {
+	fd, err := fh.Open()
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+
+	content, err := ioutil.ReadAll(fd)
+	if err != nil {
+		return "", err
+	}
+
+	contentType := fh.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return encodeBodyData(content, contentType), nil
+}
+
+// encodeBodyData returns data as a string when it is valid UTF-8,
+// otherwise as a base64 data URL so it can be embedded in JSON.
+func encodeBodyData(data []byte, contentType string) string {
+	if utf8.Valid(data) {
+		return string(data)
+	}
+
+	return fmt.Sprintf("data:%s;base64,%s", contentType, base64.StdEncoding.EncodeToString(data))
+}
+
+type weightedStatus struct {
+	code   int
+	weight float64
+}
+
+// parseStatusCodes parses the {codes} path component of /status,
+// e.g. "200", "200,500" or "200:0.7,500:0.3". Codes without a weight get weight 1.
+func parseStatusCodes(raw string) ([]weightedStatus, error) {
+	var choices []weightedStatus
+
+	for _, item := range strings.Split(raw, ",") {
+		codeRaw, weightRaw := item, "1"
+		if i := strings.Index(item, ":"); i >= 0 {
+			codeRaw, weightRaw = item[:i], item[i+1:]
+		}
+
+		code, err := strconv.Atoi(strings.TrimSpace(codeRaw))
+		if err != nil || code < 200 || code > 599 {
+			return nil, fmt.Errorf("Invalid status code %q", codeRaw)
+		}
+		weight, err := strconv.ParseFloat(strings.TrimSpace(weightRaw), 64)
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("Invalid weight %q", weightRaw)
+		}
+
+		choices = append(choices, weightedStatus{code: code, weight: weight})
+	}
+
+	return choices, nil
+}
+
+// chooseStatusCode picks a status code from choices, the probability of each
+// code is proportional to its weight.
+func chooseStatusCode(choices []weightedStatus, randGenerator *rand.Rand) int {
+	total := 0.0
+	for _, choice := range choices {
+		total += choice.weight
+	}
+
+	x := randGenerator.Float64() * total
+	for _, choice := range choices {
+		if x < choice.weight {
+			return choice.code
+		}
+		x -= choice.weight
+	}
+
+	return choices[len(choices)-1].code
+}
+
+// parseSeconds parses a non-negative number of seconds such as "1.5".
+func parseSeconds(raw string) (time.Duration, error) {
+	seconds, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(seconds) || seconds < 0 || seconds > math.MaxInt64/float64(time.Second) {
+		return 0, fmt.Errorf("seconds out of range: %s", raw)
+	}
+
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+func parseSecondsDefault(raw string, def time.Duration) (time.Duration, error) {
+	if raw == "" {
+		return def, nil
+	}
+	return parseSeconds(raw)
+}
+
+// byteRange is a satisfiable range of a Range header.
+type byteRange struct {
+	start, length int64
+}
+
+func (br byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", br.start, br.start+br.length-1, size)
+}
+
+var errInvalidRange = errors.New("invalid range")
+
+// maxRanges 是 Range 头部中最多接受的范围个数
+const maxRanges = 100
+
+// parseRange parses a "bytes=" Range header (RFC 7233) for a resource of size bytes.
+// It returns no ranges for an empty header, and an error when the header is
+// malformed or none of its ranges is satisfiable. Like net/http.ServeContent,
+// the ranges are ignored when there are too many of them or they add up to
+// more than the resource, the whole resource is served instead.
+func parseRange(header string, size int64) ([]byteRange, error) {
+	if header == "" {
+		return nil, nil
+	}
+
+	const prefix = "bytes="
+	if !strings.HasPrefix(header, prefix) {
+		return nil, errInvalidRange
+	}
+
+	var ranges []byteRange
+	for _, spec := range strings.Split(header[len(prefix):], ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		i := strings.Index(spec, "-")
+		if i < 0 {
+			return nil, errInvalidRange
+		}
+		startRaw, endRaw := strings.TrimSpace(spec[:i]), strings.TrimSpace(spec[i+1:])
+
+		var br byteRange
+		if startRaw == "" {
+			// 后缀形式 "-n" 表示最后 n 个字节
+			n, err := strconv.ParseInt(endRaw, 10, 64)
+			if err != nil || n < 0 {
+				return nil, errInvalidRange
+			}
+			if n == 0 {
+				continue
+			}
+			if n > size {
+				n = size
+			}
+			br = byteRange{start: size - n, length: n}
+		} else {
+			start, err := strconv.ParseInt(startRaw, 10, 64)
+			if err != nil || start < 0 {
+				return nil, errInvalidRange
+			}
+			if start >= size {
+				continue
+			}
+
+			end := size - 1
+			if endRaw != "" {
+				end, err = strconv.ParseInt(endRaw, 10, 64)
+				if err != nil || start > end {
+					return nil, errInvalidRange
+				}
+				if end >= size {
+					end = size - 1
+				}
+			}
+			br = byteRange{start: start, length: end - start + 1}
+		}
+
+		ranges = append(ranges, br)
+	}
+
+	if len(ranges) == 0 {
+		return nil, errors.New("range not satisfiable")
 	}
 
-	for k, _ := range values {
-		queryArgs[k] = values.Get(k)
+	// 重叠的范围可以让很小的请求得到很大的响应
+	var total int64
+	for _, br := range ranges {
+		total += br.length
+	}
+	if len(ranges) > maxRanges || total > size {
+		return nil, nil
+	}
+	return ranges, nil
+}
+
+// entityTag is an entity tag of an If-Match or If-None-Match header,
+// the wildcard "*" is returned with tag "*".
+type entityTag struct {
+	tag  string
+	weak bool
+}
+
+// parseEntityTags parses a comma separated list of entity tags, tags without
+// quotes are accepted as well for lenient clients.
+func parseEntityTags(header string) []entityTag {
+	var tags []entityTag
+
+	s := header
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			break
+		}
+		if s[0] == '*' {
+			tags = append(tags, entityTag{tag: "*"})
+			s = s[1:]
+			continue
+		}
+
+		weak := false
+		if strings.HasPrefix(s, "W/") {
+			weak = true
+			s = s[2:]
+		}
+
+		if s == "" || s[0] != '"' {
+			end := strings.IndexByte(s, ',')
+			if end < 0 {
+				end = len(s)
+			}
+			tags = append(tags, entityTag{tag: strings.TrimSpace(s[:end]), weak: weak})
+			s = s[end:]
+			continue
+		}
+
+		// 引号内可以包含逗号
+		end := strings.IndexByte(s[1:], '"')
+		if end < 0 {
+			tags = append(tags, entityTag{tag: s[1:], weak: weak})
+			break
+		}
+		tags = append(tags, entityTag{tag: s[1 : end+1], weak: weak})
+		s = s[end+2:]
 	}
 
-	return queryArgs, nil
+	return tags
+}
+
+// matchEntityTag reports whether etag matches one of tags. The weak comparison
+// ignores the W/ prefix, the strong comparison never matches weak tags (RFC 7232).
+func matchEntityTag(tags []entityTag, etag string, weakComparison bool) bool {
+	for _, t := range tags {
+		if t.tag == "*" {
+			return true
+		}
+		if t.tag == etag && (weakComparison || !t.weak) {
+			return true
+		}
+	}
+	return false
 }
@@ -102,7 +102,7 @@ func ImgHandler(w http.ResponseWriter, r *http.Request) {
 		ImgPngHandler(w, r)
 		return
 	} else {
-		http.Error(w, "Invalid Accept", http.StatusNotAcceptable)
+		writeError(w, http.StatusNotAcceptable, "Invalid Accept")
 		return
 	}
 
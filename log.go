@@ -2,6 +2,7 @@ package httpbin
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
@@ -20,16 +21,22 @@ func NewWebLogger() *WebLogger {
 	}
 }
 
+// InternalErrorPrint logs the message and writes it as a 500 JSON error.
 func (l *WebLogger) InternalErrorPrint(w http.ResponseWriter, v ...interface{}) {
 	msg := fmt.Sprint(v...)
-	http.Error(w, msg, http.StatusInternalServerError)
+	writeError(w, http.StatusInternalServerError, msg)
 
 	l.Logger.Output(2, msg)
 }
 
 func (l *WebLogger) InternalErrorPrintf(w http.ResponseWriter, format string, v ...interface{}) {
 	msg := fmt.Sprintf(format, v...)
-	http.Error(w, msg, http.StatusInternalServerError)
+	writeError(w, http.StatusInternalServerError, msg)
 
 	l.Logger.Output(2, msg)
 }
+
+// SetLogOutput sets the destination of the logs of the handlers.
+func SetLogOutput(w io.Writer) {
+	logger.SetOutput(w)
+}
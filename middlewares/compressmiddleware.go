@@ -0,0 +1,219 @@
+package middlewares
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// supportedEncodings 按优先级排列，q 值相同时选择靠前的编码
+var supportedEncodings = []string{"br", "gzip", "deflate"}
+
+// compressibleTypes 是会被压缩的 Content-Type 前缀
+var compressibleTypes = []string{
+	"application/json",
+	"application/xml",
+	"application/x-yaml",
+	"application/yaml",
+	"application/msgpack",
+	"text/",
+}
+
+// NewEncoder returns a writer compressing into w with the given content coding,
+// "deflate" is the zlib format as required by RFC 7230.
+func NewEncoder(encoding string, w io.Writer) (io.WriteCloser, error) {
+	switch encoding {
+	case "gzip":
+		return gzip.NewWriter(w), nil
+	case "deflate":
+		return zlib.NewWriter(w), nil
+	case "br":
+		return brotli.NewWriter(w), nil
+	default:
+		return nil, fmt.Errorf("unsupported content coding %q", encoding)
+	}
+}
+
+// NegotiateEncoding returns the preferred supported content coding of an
+// Accept-Encoding header, or "" when the response should not be compressed.
+func NegotiateEncoding(header string) string {
+	qvalues := make(map[string]float64)
+	for _, item := range strings.Split(header, ",") {
+		params := strings.Split(item, ";")
+		coding := strings.ToLower(strings.TrimSpace(params[0]))
+		if coding == "" {
+			continue
+		}
+		if coding == "x-gzip" {
+			coding = "gzip"
+		}
+
+		q := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				v, err := strconv.ParseFloat(param[2:], 64)
+				if err != nil {
+					v = 0
+				}
+				q = v
+			}
+		}
+		qvalues[coding] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, encoding := range supportedEncodings {
+		q, ok := qvalues[encoding]
+		if !ok {
+			if q, ok = qvalues["*"]; !ok {
+				continue
+			}
+		}
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+
+	return best
+}
+
+func compressible(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	for _, prefix := range compressibleTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+type compressResponseWriter struct {
+	http.ResponseWriter
+	r           *http.Request
+	encoding    string
+	encoder     io.WriteCloser
+	wroteHeader bool
+	// pendingCode 是推迟发送的状态码，等到第一次写入非空的响应体时才开始压缩
+	pendingCode int
+}
+
+// WriteHeader decides whether the response may be compressed, responses which
+// are already encoded, partial or not compressible are sent as they are. The
+// header of a compressible response is held back until the body is written,
+// so an empty response is not turned into an empty compressed stream.
+func (cw *compressResponseWriter) WriteHeader(code int) {
+	if cw.wroteHeader {
+		if cw.pendingCode == 0 {
+			cw.ResponseWriter.WriteHeader(code)
+		}
+		return
+	}
+	cw.wroteHeader = true
+
+	header := cw.Header()
+	if cw.encoding != "" &&
+		header.Get("Content-Encoding") == "" &&
+		header.Get("Content-Range") == "" &&
+		code >= http.StatusOK && code != http.StatusNoContent && code != http.StatusNotModified &&
+		cw.r.Method != http.MethodHead &&
+		compressible(header.Get("Content-Type")) {
+		cw.pendingCode = code
+		return
+	}
+
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+// startEncoder sends the held back header and starts compressing the body.
+func (cw *compressResponseWriter) startEncoder() {
+	code := cw.pendingCode
+	cw.pendingCode = 0
+
+	header := cw.Header()
+	if encoder, err := NewEncoder(cw.encoding, cw.ResponseWriter); err == nil {
+		header.Set("Content-Encoding", cw.encoding)
+		header.Del("Content-Length")
+		cw.encoder = encoder
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *compressResponseWriter) Write(p []byte) (int, error) {
+	if !cw.wroteHeader {
+		if cw.Header().Get("Content-Type") == "" {
+			cw.Header().Set("Content-Type", http.DetectContentType(p))
+		}
+		cw.WriteHeader(http.StatusOK)
+	}
+
+	if cw.pendingCode != 0 {
+		if len(p) == 0 {
+			return 0, nil
+		}
+		cw.startEncoder()
+	}
+
+	if cw.encoder != nil {
+		return cw.encoder.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// Flush starts the compression of a pending response, a flushing handler is
+// streaming its body.
+func (cw *compressResponseWriter) Flush() {
+	if cw.pendingCode != 0 {
+		cw.startEncoder()
+	}
+	if flusher, ok := cw.encoder.(interface{ Flush() error }); ok {
+		flusher.Flush()
+	}
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// close finishes the compressed stream, a pending response without body is
+// sent uncompressed.
+func (cw *compressResponseWriter) close() {
+	if cw.pendingCode != 0 {
+		code := cw.pendingCode
+		cw.pendingCode = 0
+		cw.ResponseWriter.WriteHeader(code)
+	}
+	if cw.encoder != nil {
+		cw.encoder.Close()
+	}
+}
+
+// SkipCompression makes CompressMiddleware send the response uncompressed,
+// it must be called before the response header is written.
+func SkipCompression(w http.ResponseWriter) {
+	if cw, ok := w.(*compressResponseWriter); ok {
+		cw.encoding = ""
+	}
+}
+
+// CompressMiddleware compresses responses with the best content coding of the
+// Accept-Encoding header, honoring quality values.
+func CompressMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		cw := &compressResponseWriter{
+			ResponseWriter: w,
+			r:              r,
+			encoding:       NegotiateEncoding(r.Header.Get("Accept-Encoding")),
+		}
+		defer cw.close()
+
+		next.ServeHTTP(cw, r)
+	})
+}
@@ -0,0 +1,407 @@
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type JWTConfig struct {
+	// KeyFile is a JWKS document or a PEM file with public keys or certificates.
+	KeyFile string
+	// SecretFile contains the HS256 secret. It is a separate setting so a
+	// public key given by mistake is never used as a secret anyone can sign with.
+	SecretFile string
+	Audience   string
+	Issuer     string
+	// Leeway is the allowed clock skew when checking exp and nbf.
+	Leeway time.Duration
+}
+
+// JWT is a verified token.
+type JWT struct {
+	Header map[string]interface{} `json:"header"`
+	Claims map[string]interface{} `json:"claims"`
+}
+
+type jwtKey struct {
+	kid string
+	key interface{}
+}
+
+type jwtContextKey struct{}
+
+type JWTMiddleware struct {
+	keys     []jwtKey
+	audience string
+	issuer   string
+	leeway   time.Duration
+}
+
+func NewJWTMiddleware(config JWTConfig) (*JWTMiddleware, error) {
+	if config.KeyFile == "" && config.SecretFile == "" {
+		return nil, errors.New("a JWT key file or secret file is required")
+	}
+
+	var keys []jwtKey
+	if config.KeyFile != "" {
+		data, err := ioutil.ReadFile(config.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		keys, err = parseJWTKeys(data)
+		if err != nil {
+			return nil, fmt.Errorf("load JWT keys from %s: %s", config.KeyFile, err)
+		}
+	}
+
+	if config.SecretFile != "" {
+		data, err := ioutil.ReadFile(config.SecretFile)
+		if err != nil {
+			return nil, err
+		}
+		secret := bytes.TrimSpace(data)
+		if len(secret) == 0 {
+			return nil, fmt.Errorf("load JWT secret from %s: empty secret", config.SecretFile)
+		}
+		keys = append(keys, jwtKey{key: secret})
+	}
+
+	return &JWTMiddleware{
+		keys:     keys,
+		audience: config.Audience,
+		issuer:   config.Issuer,
+		leeway:   config.Leeway,
+	}, nil
+}
+
+func (jm *JWTMiddleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if len(auth) < 7 || !strings.EqualFold(auth[:7], "bearer ") {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeUnauthorized(w, "Missing Bearer Token")
+			return
+		}
+
+		token, err := jm.Verify(strings.TrimSpace(auth[7:]), time.Now())
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="invalid_token", error_description=%q`, err.Error()))
+			writeUnauthorized(w, err.Error())
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), jwtContextKey{}, token)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// writeUnauthorized writes a 401 JSON error in the format of the httpbin handlers.
+func writeUnauthorized(w http.ResponseWriter, message string) {
+	js, _ := json.Marshal(map[string]interface{}{
+		"status":  http.StatusUnauthorized,
+		"error":   http.StatusText(http.StatusUnauthorized),
+		"message": message,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	w.Write(js)
+}
+
+// JWTFromContext returns the token verified by JWTMiddleware.
+func JWTFromContext(ctx context.Context) (*JWT, bool) {
+	token, ok := ctx.Value(jwtContextKey{}).(*JWT)
+	return token, ok
+}
+
+// Verify checks the signature of a compact serialized token with the
+// configured keys and validates its exp, nbf, aud and iss claims.
+func (jm *JWTMiddleware) Verify(raw string, now time.Time) (*JWT, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	token := &JWT{}
+	if err := decodeJWTSegment(parts[0], &token.Header); err != nil {
+		return nil, fmt.Errorf("malformed header: %s", err)
+	}
+	if err := decodeJWTSegment(parts[1], &token.Claims); err != nil {
+		return nil, fmt.Errorf("malformed claims: %s", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed signature: %s", err)
+	}
+
+	alg, _ := token.Header["alg"].(string)
+	kid, _ := token.Header["kid"].(string)
+	signed := []byte(parts[0] + "." + parts[1])
+
+	verified := false
+	for _, key := range jm.keys {
+		if kid != "" && key.kid != "" && key.kid != kid {
+			continue
+		}
+		ok, err := verifyJWTSignature(alg, key.key, signed, signature)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, errors.New("invalid signature")
+	}
+
+	if err := jm.validateClaims(token.Claims, now); err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+func (jm *JWTMiddleware) validateClaims(claims map[string]interface{}, now time.Time) error {
+	// exp 和 nbf 必须是数字，忽略其他类型的值等于不校验
+	if exp, ok := claims["exp"]; ok {
+		exp, ok := exp.(float64)
+		if !ok {
+			return errors.New("invalid exp claim")
+		}
+		if now.After(time.Unix(int64(exp), 0).Add(jm.leeway)) {
+			return errors.New("token is expired")
+		}
+	}
+	if nbf, ok := claims["nbf"]; ok {
+		nbf, ok := nbf.(float64)
+		if !ok {
+			return errors.New("invalid nbf claim")
+		}
+		if now.Before(time.Unix(int64(nbf), 0).Add(-jm.leeway)) {
+			return errors.New("token is not valid yet")
+		}
+	}
+
+	if jm.issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != jm.issuer {
+			return errors.New("invalid issuer")
+		}
+	}
+
+	if jm.audience != "" {
+		found := false
+		switch aud := claims["aud"].(type) {
+		case string:
+			found = aud == jm.audience
+		case []interface{}:
+			for _, item := range aud {
+				if item == jm.audience {
+					found = true
+					break
+				}
+			}
+		}
+		if !found {
+			return errors.New("invalid audience")
+		}
+	}
+
+	return nil
+}
+
+func decodeJWTSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// verifyJWTSignature returns false when the key type doesn't match alg,
+// so the caller can try the next key.
+func verifyJWTSignature(alg string, key interface{}, signed, signature []byte) (bool, error) {
+	digest := sha256.Sum256(signed)
+
+	switch alg {
+	case "HS256":
+		secret, ok := key.([]byte)
+		if !ok {
+			return false, nil
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(signed)
+		return hmac.Equal(mac.Sum(nil), signature), nil
+	case "RS256":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return false, nil
+		}
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature) == nil, nil
+	case "ES256":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || pub.Curve != elliptic.P256() {
+			return false, nil
+		}
+		if len(signature) != 64 {
+			return false, nil
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(pub, digest[:], r, s), nil
+	default:
+		return false, fmt.Errorf("unsupported algorithm %q", alg)
+	}
+}
+
+// parseJWTKeys loads keys from a JWKS document or PEM blocks, anything else is
+// an error. HMAC secrets are only read from JWTConfig.SecretFile.
+func parseJWTKeys(data []byte) ([]jwtKey, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return nil, errors.New("empty key file")
+	}
+
+	if trimmed[0] == '{' {
+		return parseJWKS(trimmed)
+	}
+
+	if bytes.HasPrefix(trimmed, []byte("-----BEGIN")) {
+		return parsePEMKeys(trimmed)
+	}
+
+	return nil, errors.New("unrecognized key file, excepted a JWKS document or PEM public keys")
+}
+
+func parsePEMKeys(data []byte) ([]jwtKey, error) {
+	var keys []jwtKey
+
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		switch block.Type {
+		case "PUBLIC KEY":
+			pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, jwtKey{key: pub})
+		case "RSA PUBLIC KEY":
+			pub, err := x509.ParsePKCS1PublicKey(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, jwtKey{key: pub})
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, jwtKey{key: cert.PublicKey})
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("no public key found in PEM data")
+	}
+	return keys, nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+func parseJWKS(data []byte) ([]jwtKey, error) {
+	var jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, err
+	}
+
+	var keys []jwtKey
+	for _, k := range jwks.Keys {
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %s", k.Kid, err)
+		}
+		if key != nil {
+			keys = append(keys, jwtKey{kid: k.Kid, key: key})
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("no supported key found in JWKS")
+	}
+	return keys, nil
+}
+
+// publicKey returns nil for unsupported key types, they are skipped.
+func (k jwk) publicKey() (interface{}, error) {
+	decode := base64.RawURLEncoding.DecodeString
+
+	switch k.Kty {
+	case "oct":
+		return decode(k.K)
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, nil
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	default:
+		return nil, nil
+	}
+}
@@ -0,0 +1,251 @@
+package httpbin
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ProxyPolicy decides which peers are trusted to report the client address
+// in the Forwarded, X-Forwarded-For and X-Real-IP headers, the zero value
+// trusts nobody.
+type ProxyPolicy struct {
+	// TrustedProxies lists the networks of the trusted reverse proxies.
+	TrustedProxies []*net.IPNet
+	// ClientHeader is the header the trusted proxies write the client address
+	// to, one of the proxyHeaders, X-Forwarded-For when empty. The other
+	// headers are ignored since the client may have sent them. It also selects
+	// where ForwardedURL reads the scheme and host: Forwarded when it is
+	// Forwarded, X-Forwarded-Proto and X-Forwarded-Host otherwise.
+	ClientHeader string
+}
+
+// proxyHeaders 是可以携带客户端地址的头部
+var proxyHeaders = []string{"X-Forwarded-For", "Forwarded", "X-Real-IP"}
+
+// ParseProxyHeader returns the canonical name of a header of proxyHeaders.
+func ParseProxyHeader(name string) (string, error) {
+	for _, header := range proxyHeaders {
+		if strings.EqualFold(strings.TrimSpace(name), header) {
+			return header, nil
+		}
+	}
+	return "", fmt.Errorf("invalid proxy header %q, excepted one of %s", name, strings.Join(proxyHeaders, ", "))
+}
+
+func (p *ProxyPolicy) clientHeader() string {
+	if p.ClientHeader == "" {
+		return proxyHeaders[0]
+	}
+	return http.CanonicalHeaderKey(p.ClientHeader)
+}
+
+// ParseTrustedProxies parses a list of CIDRs, plain IP addresses are
+// treated as single host networks.
+func ParseTrustedProxies(items []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", item)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %s", item, err)
+		}
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+func (p *ProxyPolicy) trusted(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, network := range p.TrustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Hops returns the addresses the request went through, from the client
+// reported by the proxies to the peer of the connection. The ClientHeader is
+// ignored unless the peer is a trusted proxy.
+func (p *ProxyPolicy) Hops(r *http.Request) []string {
+	peer := stripPort(r.RemoteAddr)
+	if !p.trusted(peer) {
+		return []string{peer}
+	}
+
+	var hops []string
+	switch p.clientHeader() {
+	case "Forwarded":
+		for _, element := range parseForwarded(r.Header["Forwarded"]) {
+			node, ok := element["for"]
+			if !ok {
+				node = "unknown"
+			}
+			hops = append(hops, stripPort(node))
+		}
+	case "X-Real-Ip":
+		if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); realIP != "" {
+			hops = append(hops, stripPort(realIP))
+		}
+	default:
+		for _, value := range r.Header["X-Forwarded-For"] {
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					hops = append(hops, stripPort(item))
+				}
+			}
+		}
+	}
+
+	return append(hops, peer)
+}
+
+// ClientIP returns the rightmost hop which is not a trusted proxy, the
+// leftmost hop when every hop is trusted. A hop which is not an IP address,
+// such as "unknown", can't be the client, the proxy which reported it is
+// returned instead.
+func (p *ProxyPolicy) ClientIP(r *http.Request) string {
+	hops := p.Hops(r)
+
+	i := len(hops) - 1
+	for i > 0 && p.trusted(hops[i]) {
+		i--
+	}
+	if net.ParseIP(hops[i]) == nil && i < len(hops)-1 {
+		i++
+	}
+	return hops[i]
+}
+
+// ForwardedURL returns the scheme, host and path prefix of the URL the
+// client requested, as reported by a trusted proxy in the Forwarded header
+// when it is the ClientHeader, otherwise in X-Forwarded-Proto and
+// X-Forwarded-Host, the prefix is read from X-Forwarded-Prefix. Proxies append
+// to these headers, so the rightmost value, set by the nearest trusted proxy,
+// is used. Empty strings are returned for unknown parts.
+func (p *ProxyPolicy) ForwardedURL(r *http.Request) (scheme, host, prefix string) {
+	if !p.trusted(stripPort(r.RemoteAddr)) {
+		return "", "", ""
+	}
+
+	if p.clientHeader() == "Forwarded" {
+		if elements := parseForwarded(r.Header["Forwarded"]); len(elements) > 0 {
+			last := elements[len(elements)-1]
+			scheme, host = last["proto"], last["host"]
+		}
+	} else {
+		scheme = lastHeaderValue(r.Header["X-Forwarded-Proto"])
+		host = lastHeaderValue(r.Header["X-Forwarded-Host"])
+	}
+	prefix = lastHeaderValue(r.Header["X-Forwarded-Prefix"])
+
+	// 只接受合法的值，避免伪造的头部注入 URL
+	scheme = strings.ToLower(scheme)
+	if scheme != "http" && scheme != "https" {
+		scheme = ""
+	}
+	if strings.ContainsAny(host, "/\\?#@ ") {
+		host = ""
+	}
+	prefix = strings.TrimRight(prefix, "/")
+	if prefix != "" && (!strings.HasPrefix(prefix, "/") || strings.HasPrefix(prefix, "//") || strings.ContainsAny(prefix, "\\?# ")) {
+		prefix = ""
+	}
+
+	return scheme, host, prefix
+}
+
+// lastHeaderValue returns the rightmost item of comma separated header values.
+func lastHeaderValue(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	value := values[len(values)-1]
+	if i := strings.LastIndex(value, ","); i >= 0 {
+		value = value[i+1:]
+	}
+	return strings.TrimSpace(value)
+}
+
+// stripPort removes the port and the IPv6 brackets of a host, the
+// "host:port" of RemoteAddr as well as the "[::1]:8080" of Forwarded.
+func stripPort(hostport string) string {
+	hostport = strings.TrimSpace(hostport)
+	if host, _, err := net.SplitHostPort(hostport); err == nil {
+		return host
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(hostport, "["), "]")
+}
+
+// parseForwarded parses RFC 7239 Forwarded header values into their
+// elements, parameter names are lowercased and quoted values unquoted.
+func parseForwarded(values []string) []map[string]string {
+	var elements []map[string]string
+
+	for _, value := range values {
+		element := make(map[string]string)
+		var pair strings.Builder
+		quoted := false
+
+		appendElement := func() {
+			if len(element) > 0 {
+				elements = append(elements, element)
+			}
+			element = make(map[string]string)
+		}
+
+		flushPair := func() {
+			item := strings.TrimSpace(pair.String())
+			pair.Reset()
+			if i := strings.Index(item, "="); i > 0 {
+				v := strings.TrimSpace(item[i+1:])
+				if len(v) >= 2 && v[0] == '"' && v[len(v)-1] == '"' {
+					v = strings.Replace(v[1:len(v)-1], `\"`, `"`, -1)
+				}
+				element[strings.ToLower(strings.TrimSpace(item[:i]))] = v
+			}
+		}
+
+		for _, c := range value {
+			switch {
+			case c == '"':
+				quoted = !quoted
+				pair.WriteRune(c)
+			case c == ';' && !quoted:
+				flushPair()
+			case c == ',' && !quoted:
+				flushPair()
+				appendElement()
+			default:
+				pair.WriteRune(c)
+			}
+		}
+		flushPair()
+		appendElement()
+	}
+
+	return elements
+}
@@ -0,0 +1,92 @@
+package httpbin
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// RedirectPolicy decides which targets /redirect-to may redirect to,
+// the zero value allows every target.
+type RedirectPolicy struct {
+	// RelativeOnly rejects every target with a scheme or a host.
+	RelativeOnly bool
+	// AllowedHosts, when not empty, lists the only hosts absolute targets may point to.
+	// "*.example.com" matches every subdomain of example.com.
+	AllowedHosts []string
+	// DeniedHosts lists the hosts absolute targets must not point to, it takes
+	// precedence over AllowedHosts.
+	DeniedHosts []string
+}
+
+func (p *RedirectPolicy) restricted() bool {
+	return p.RelativeOnly || len(p.AllowedHosts) > 0 || len(p.DeniedHosts) > 0
+}
+
+// Check returns an error explaining why target is rejected.
+func (p *RedirectPolicy) Check(target string) error {
+	if !p.restricted() {
+		return nil
+	}
+
+	// 发送 Location 时首尾的空白会被去掉，" //evil.com" 实际跳转到 "//evil.com"
+	if target != strings.TrimSpace(target) {
+		return errors.New("redirect target must not start or end with whitespace")
+	}
+
+	// 浏览器会把 "/\evil.com" 当作 "//evil.com" 处理，"///evil.com" 等多个斜杠开头
+	// 的地址也会跳转到 evil.com，去掉多余的斜杠后按协议相对地址解析
+	normalized := strings.Replace(target, `\`, "/", -1)
+	if strings.HasPrefix(normalized, "//") {
+		normalized = "//" + strings.TrimLeft(normalized, "/")
+	}
+	u, err := url.Parse(normalized)
+	if err != nil {
+		return fmt.Errorf("invalid redirect target: %s", err)
+	}
+	if u.Scheme == "" && u.Host == "" {
+		return nil
+	}
+
+	if p.RelativeOnly {
+		return errors.New("only relative redirect targets are allowed")
+	}
+	if u.Scheme != "" && u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("scheme %q is not allowed", u.Scheme)
+	}
+	// 浏览器会把 "http:///evil.com" 和 "https:evil.com" 当作 evil.com 处理
+	if u.Host == "" || u.Hostname() == "" {
+		return errors.New("absolute redirect target must have a host")
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if matchHosts(host, p.DeniedHosts) {
+		return fmt.Errorf("host %q is denied", host)
+	}
+	if len(p.AllowedHosts) > 0 && !matchHosts(host, p.AllowedHosts) {
+		return fmt.Errorf("host %q is not in the allowed hosts", host)
+	}
+
+	return nil
+}
+
+func matchHosts(host string, patterns []string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if h, _, err := net.SplitHostPort(pattern); err == nil {
+			pattern = h
+		}
+
+		if strings.HasPrefix(pattern, "*.") {
+			if strings.HasSuffix(host, pattern[1:]) {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
+
+	return false
+}
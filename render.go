@@ -0,0 +1,366 @@
+package httpbin
+
+/*
+ * Response rendering with content negotiation
+ */
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"gopkg.in/yaml.v2"
+)
+
+type renderer struct {
+	contentType string
+	marshal     func(v interface{}) ([]byte, error)
+}
+
+var renderers = map[string]renderer{
+	"json":    {"application/json", json.Marshal},
+	"pretty":  {"application/json", marshalPrettyJSON},
+	"yaml":    {"application/x-yaml", yaml.Marshal},
+	"xml":     {"application/xml", marshalXML},
+	"msgpack": {"application/msgpack", msgpack.Marshal},
+}
+
+// acceptFormats maps the media types of the Accept header to formats,
+// in the order preferred when the client accepts several of them equally.
+var acceptFormats = []struct {
+	mediaType string
+	format    string
+}{
+	{"application/json", "json"},
+	{"application/x-yaml", "yaml"},
+	{"application/yaml", "yaml"},
+	{"text/yaml", "yaml"},
+	{"application/xml", "xml"},
+	{"text/xml", "xml"},
+	{"application/msgpack", "msgpack"},
+	{"application/x-msgpack", "msgpack"},
+}
+
+var errNotAcceptable = errors.New("Client did not request a supported media type.")
+
+// negotiateFormat returns the format of the response, the format query
+// parameter takes precedence over the Accept header. JSON is the default, other
+// formats are used when the client prefers them by name. JSON is indented when
+// the pretty query parameter is present.
+func negotiateFormat(r *http.Request) (string, error) {
+	format, err := negotiateMediaType(r)
+	if err != nil {
+		return "", err
+	}
+
+	if _, ok := r.URL.Query()["pretty"]; ok && format == "json" {
+		format = "pretty"
+	}
+	return format, nil
+}
+
+func negotiateMediaType(r *http.Request) (string, error) {
+	if format := strings.ToLower(r.URL.Query().Get("format")); format != "" {
+		if _, ok := renderers[format]; !ok {
+			return "", errNotAcceptable
+		}
+		return format, nil
+	}
+
+	accept := r.Header.Get("Accept")
+	if strings.TrimSpace(accept) == "" {
+		return "json", nil
+	}
+
+	// 浏览器通过 */* 接受 JSON 时也会列出 application/xml 等类型，只有客户端
+	// 最想要的类型中明确列出的格式才会代替默认的 JSON
+	topQ := maxAcceptQuality(accept)
+	for _, item := range acceptFormats {
+		if q, explicit := acceptQuality(accept, item.mediaType); explicit && q > 0 && q == topQ {
+			return item.format, nil
+		}
+	}
+	if q, _ := acceptQuality(accept, "application/json"); q > 0 {
+		return "json", nil
+	}
+
+	best, bestQ := "", 0.0
+	for _, item := range acceptFormats {
+		if q, _ := acceptQuality(accept, item.mediaType); q > bestQ {
+			best, bestQ = item.format, q
+		}
+	}
+	if best == "" {
+		return "", errNotAcceptable
+	}
+
+	return best, nil
+}
+
+// acceptItems splits the Accept header into lowercased media ranges and their q values.
+func acceptItems(accept string) (mediaRanges []string, qs []float64) {
+	for _, item := range strings.Split(accept, ",") {
+		params := strings.Split(item, ";")
+
+		q := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				v, err := strconv.ParseFloat(param[2:], 64)
+				if err != nil {
+					v = 0
+				}
+				q = v
+			}
+		}
+
+		mediaRanges = append(mediaRanges, strings.ToLower(strings.TrimSpace(params[0])))
+		qs = append(qs, q)
+	}
+
+	return mediaRanges, qs
+}
+
+func maxAcceptQuality(accept string) float64 {
+	_, qs := acceptItems(accept)
+	maxQ := 0.0
+	for _, q := range qs {
+		if q > maxQ {
+			maxQ = q
+		}
+	}
+	return maxQ
+}
+
+// acceptQuality returns the q value the Accept header gives to mediaType,
+// the most specific matching media range wins. explicit is true when the
+// header names mediaType itself rather than a wildcard.
+func acceptQuality(accept string, mediaType string) (q float64, explicit bool) {
+	typ := mediaType[:strings.Index(mediaType, "/")]
+	specificity := -1
+
+	mediaRanges, qs := acceptItems(accept)
+	for i, mediaRange := range mediaRanges {
+		s := -1
+		switch mediaRange {
+		case mediaType:
+			s = 2
+		case typ + "/*":
+			s = 1
+		case "*/*":
+			s = 0
+		}
+		if s <= specificity {
+			continue
+		}
+		q, specificity = qs[i], s
+	}
+
+	return q, specificity == 2
+}
+
+// normalizeResult converts result to maps, slices and scalars through JSON,
+// so every format uses the same keys as the JSON output.
+func normalizeResult(result interface{}) (interface{}, error) {
+	js, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(js))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	return convertNumbers(v), nil
+}
+
+func convertNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = convertNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = convertNumbers(item)
+		}
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return v
+}
+
+// renderResult serializes result in the format negotiated for the request.
+func renderResult(r *http.Request, result interface{}) (string, []byte, error) {
+	format, err := negotiateFormat(r)
+	if err != nil {
+		return "", nil, err
+	}
+	render := renderers[format]
+
+	if format == "json" {
+		data, err := json.Marshal(result)
+		return render.contentType, data, err
+	}
+
+	v, err := normalizeResult(result)
+	if err != nil {
+		return "", nil, err
+	}
+	data, err := render.marshal(v)
+	return render.contentType, data, err
+}
+
+// apiError is the body of every JSON error response.
+type apiError struct {
+	Status  int      `json:"status"`
+	Error   string   `json:"error"`
+	Message string   `json:"message"`
+	Accept  []string `json:"accept,omitempty"`
+}
+
+// writeBody writes data with its Content-Type and Content-Length.
+func writeBody(w http.ResponseWriter, code int, contentType string, data []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(code)
+	w.Write(data)
+}
+
+// writeJSON writes v as JSON with the given status code, regardless of the
+// format requested by the client.
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	js, err := json.Marshal(v)
+	if err != nil {
+		// apiError 总是可以被序列化
+		js, _ = json.Marshal(apiError{
+			Status:  http.StatusInternalServerError,
+			Error:   http.StatusText(http.StatusInternalServerError),
+			Message: err.Error(),
+		})
+		code = http.StatusInternalServerError
+	}
+
+	writeBody(w, code, "application/json", js)
+}
+
+// writeError writes a JSON error response like
+// {"status": 400, "error": "Bad Request", "message": "..."}.
+func writeError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, apiError{
+		Status:  code,
+		Error:   http.StatusText(code),
+		Message: message,
+	})
+}
+
+func writeNotAcceptable(w http.ResponseWriter) {
+	var accept []string
+	for _, item := range acceptFormats {
+		accept = append(accept, item.mediaType)
+	}
+
+	writeJSON(w, http.StatusNotAcceptable, apiError{
+		Status:  http.StatusNotAcceptable,
+		Error:   http.StatusText(http.StatusNotAcceptable),
+		Message: errNotAcceptable.Error(),
+		Accept:  accept,
+	})
+}
+
+// writeResult writes result as JSON, pretty JSON, YAML, XML or MessagePack
+// according to the format and pretty parameters and the Accept header.
+func writeResult(w http.ResponseWriter, r *http.Request, result interface{}) {
+	contentType, data, err := renderResult(r, result)
+	if err == errNotAcceptable {
+		writeNotAcceptable(w)
+		return
+	}
+	if err != nil {
+		logger.InternalErrorPrint(w, err.Error())
+		return
+	}
+
+	writeBody(w, http.StatusOK, contentType, data)
+}
+
+func marshalPrettyJSON(v interface{}) ([]byte, error) {
+	return json.MarshalIndent(v, "", "  ")
+}
+
+var xmlNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// marshalXML encodes normalized results inside a <result> element. Map keys
+// become element names, keys which are not valid names are written as
+// <entry key="...">, list items as <item>.
+func marshalXML(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+
+	encoder := xml.NewEncoder(&buf)
+	encoder.Indent("", "  ")
+	if err := encodeXMLElement(encoder, xml.StartElement{Name: xml.Name{Local: "result"}}, v); err != nil {
+		return nil, err
+	}
+	if err := encoder.Flush(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func encodeXMLElement(encoder *xml.Encoder, start xml.StartElement, v interface{}) error {
+	if err := encoder.EncodeToken(start); err != nil {
+		return err
+	}
+
+	switch v := v.(type) {
+	case nil:
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			child := xml.StartElement{Name: xml.Name{Local: k}}
+			if !xmlNameRegexp.MatchString(k) || strings.HasPrefix(strings.ToLower(k), "xml") {
+				child = xml.StartElement{
+					Name: xml.Name{Local: "entry"},
+					Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: k}},
+				}
+			}
+			if err := encodeXMLElement(encoder, child, v[k]); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if err := encodeXMLElement(encoder, xml.StartElement{Name: xml.Name{Local: "item"}}, item); err != nil {
+				return err
+			}
+		}
+	default:
+		if err := encoder.EncodeToken(xml.CharData(fmt.Sprint(v))); err != nil {
+			return err
+		}
+	}
+
+	return encoder.EncodeToken(start.End())
+}
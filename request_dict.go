@@ -0,0 +1,90 @@
+package httpbin
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Keys available in a request description, same as the arguments of get_dict in Python httpbin.
+const (
+	dictURL     = "url"
+	dictArgs    = "args"
+	dictForm    = "form"
+	dictData    = "data"
+	dictOrigin  = "origin"
+	dictHeaders = "headers"
+	dictFiles   = "files"
+	dictJSON    = "json"
+	dictMethod  = "method"
+)
+
+// bodyDictKeys 是需要读取请求体的字段
+var bodyDictKeys = map[string]bool{
+	dictForm:  true,
+	dictData:  true,
+	dictFiles: true,
+	dictJSON:  true,
+}
+
+// getDict returns a description of the request which only contains the given keys.
+// The request body is only read when one of form, data, files or json is selected.
+func getDict(r *http.Request, keys ...string) (map[string]interface{}, error) {
+	var body *requestBody
+	for _, key := range keys {
+		if bodyDictKeys[key] {
+			var err error
+			body, err = parseRequestBody(r)
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+
+	result := make(map[string]interface{})
+	for _, key := range keys {
+		switch key {
+		case dictURL:
+			result[key] = getBaseURL(r) + r.URL.RequestURI()
+		case dictArgs:
+			queryArgs, err := getQueryArgs(r)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = queryArgs
+		case dictForm:
+			result[key] = flattenValues(body.form)
+		case dictData:
+			result[key] = body.data
+		case dictOrigin:
+			result[key] = getPeerIP(r)
+		case dictHeaders:
+			result[key] = getHeadersMap(r.Header)
+		case dictFiles:
+			result[key] = flattenValues(body.files)
+		case dictJSON:
+			result[key] = body.json
+		case dictMethod:
+			result[key] = r.Method
+		default:
+			return nil, fmt.Errorf("unknown request dict key %q", key)
+		}
+	}
+
+	return result, nil
+}
+
+// writeDict writes the request description with the given keys in the negotiated format.
+func writeDict(w http.ResponseWriter, r *http.Request, keys ...string) {
+	result, err := getDict(r, keys...)
+	if err == errBodyTooLarge {
+		writeError(w, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writeResult(w, r, result)
+}
@@ -1,16 +1,21 @@
 package httpbin
 
 import (
+	"bytes"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"html/template"
 	"io"
 	"math/rand"
+	"mime/multipart"
 	"net/http"
+	"net/textproto"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/bwangelme/go-httpbin/middlewares"
 	"github.com/google/uuid"
@@ -22,6 +27,24 @@ var (
 	TEMPLATE_DIR string
 	STATIC_DIR   string
 	logger       = NewWebLogger()
+
+	// JWT_MIDDLEWARE 不为空时注册 /jwt 接口，JWT_GROUPS 中的路由组也需要 JWT 认证
+	JWT_MIDDLEWARE *middlewares.JWTMiddleware
+	JWT_GROUPS     []string
+
+	// REDIRECT_POLICY 限制 /redirect-to 可以跳转的地址
+	REDIRECT_POLICY RedirectPolicy
+	// PROXY_POLICY 决定信任哪些代理转发的客户端地址
+	PROXY_POLICY ProxyPolicy
+
+	// MAX_BODY_SIZE 是读取请求体的最大字节数，0 表示不限制
+	MAX_BODY_SIZE int64 = 10 << 20
+	// MAX_BYTES 和 MAX_STREAM_BYTES 是 /bytes 和 /stream-bytes 返回的最大字节数
+	MAX_BYTES        int64 = 100 * 1024
+	MAX_STREAM_BYTES int64 = 1024 * 1024
+
+	// ENABLED_GROUPS 是开启的接口分组，分组名见 URL_GROUP_CONFIG，为空时开启所有分组
+	ENABLED_GROUPS []string
 )
 
 func init() {
@@ -30,7 +53,8 @@ func init() {
 		logger.Fatalln(err)
 	}
 	TEMPLATE_DIR = filepath.Join(CWD, "templates")
-	STATIC_DIR = filepath.Join(CWD, "static")
+	// 静态文件相对于工作目录，和 Resource 原来的行为一致，go run 和 go test 时也能找到
+	STATIC_DIR = "static"
 }
 
 func unescaped(x string) interface{} { return template.HTML(x) }
@@ -41,39 +65,94 @@ func unescaped(x string) interface{} { return template.HTML(x) }
  * ====================================
  */
 
-func IndexHandler(w http.ResponseWriter, r *http.Request) {
-	// TODO: 将模板渲染函数统一起来
-	indexTmpl, err := template.ParseGlob(filepath.Join(TEMPLATE_DIR, "*"))
+// renderTemplate renders the template file name of TEMPLATE_DIR as HTML.
+func renderTemplate(w http.ResponseWriter, name string, data interface{}) {
+	tmpl, err := template.New(name).Funcs(template.FuncMap{"html": unescaped}).ParseGlob(filepath.Join(TEMPLATE_DIR, "*"))
+	if err != nil {
+		logger.InternalErrorPrint(w, err.Error())
+		return
+	}
 
-	indexTmpl.Funcs(template.FuncMap{"html": unescaped})
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err = tmpl.ExecuteTemplate(w, name, data)
 	if err != nil {
 		logger.InternalErrorPrint(w, err.Error())
 		return
 	}
-	err = indexTmpl.ExecuteTemplate(w, "index.html", map[string]interface{}{
+}
+
+func IndexHandler(w http.ResponseWriter, r *http.Request) {
+	renderTemplate(w, "index.html", map[string]interface{}{
 		"URL_CONFIG":       URL_CONFIG,
-		"URL_GROUP_CONFIG": URL_GROUP_CONFIG,
+		"URL_GROUP_CONFIG": enabledGroups(),
 	})
+}
+
+// LinksHandler redirects to the first page of /links/{n}/{offset}.
+func LinksHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars == nil {
+		logger.Println("INVALID PATH")
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/links/%s/0", vars["n"]))
+	w.WriteHeader(http.StatusFound)
+}
+
+// LinksPageHandler renders a page with n links to the other pages, n is capped at 200.
+func LinksPageHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars == nil {
+		logger.Println("INVALID PATH")
+		return
+	}
+
+	n, err := strconv.Atoi(vars["n"])
 	if err != nil {
-		logger.InternalErrorPrint(w, err.Error())
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid links number %s", vars["n"]))
 		return
 	}
-	return
+	offset, err := strconv.Atoi(vars["offset"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid links offset %s", vars["offset"]))
+		return
+	}
+	if n < 1 {
+		n = 1
+	} else if n > 200 {
+		n = 200
+	}
+
+	links := make([]int, n)
+	for i := range links {
+		links[i] = i
+	}
+
+	renderTemplate(w, "links.html", map[string]interface{}{
+		"N":      n,
+		"Offset": offset,
+		"Links":  links,
+	})
 }
 
+// IPHandler returns the client address, with the hops parameter the
+// addresses of every hop, from the client to the last proxy, are returned too.
 func IPHandler(w http.ResponseWriter, r *http.Request) {
 	ip := getPeerIP(r)
 
-	js, err := json.Marshal(struct {
-		IP string
+	var hops []string
+	if _, ok := r.URL.Query()["hops"]; ok {
+		hops = PROXY_POLICY.Hops(r)
+	}
+
+	writeResult(w, r, struct {
+		IP   string
+		Hops []string `json:",omitempty"`
 	}{
-		IP: ip,
+		IP:   ip,
+		Hops: hops,
 	})
-	if err != nil {
-		logger.InternalErrorPrint(w, err.Error())
-		return
-	}
-	w.Write(js)
 }
 
 func Base64Handler(w http.ResponseWriter, r *http.Request) {
@@ -85,99 +164,116 @@ func Base64Handler(w http.ResponseWriter, r *http.Request) {
 
 	decodedVal, err := base64.StdEncoding.DecodeString(vars["value"])
 	if err != nil {
-		logger.InternalErrorPrint(w, err.Error())
+		writeError(w, http.StatusBadRequest, "Incorrect Base64 data: "+err.Error())
 		return
 	}
 
-	fmt.Fprintf(w, string(decodedVal))
+	// 解码结果是任意文本，不能作为格式化字符串输出
+	writeBody(w, http.StatusOK, "text/plain; charset=utf-8", decodedVal)
 }
 
 func UUIDHandler(w http.ResponseWriter, r *http.Request) {
 	uuidVal := uuid.New()
 
-	js, err := json.Marshal(struct {
+	writeResult(w, r, struct {
 		UUID string
 	}{
 		UUID: uuidVal.String(),
 	})
-	if err != nil {
-		logger.InternalErrorPrint(w, err.Error())
-		return
-	}
-
-	fmt.Fprintf(w, string(js))
 }
 
 func UserAgentHandler(w http.ResponseWriter, r *http.Request) {
-	js, err := json.Marshal(struct {
+	writeResult(w, r, struct {
 		UserAgent string `json:"user-agent"`
 	}{
 		UserAgent: r.UserAgent(),
 	})
-	if err != nil {
-		logger.InternalErrorPrint(w, err.Error())
-		return
-	}
-
-	fmt.Fprintf(w, string(js))
 }
 
-func HeadersHandler(w http.ResponseWriter, r *http.Request) {
-	headers := getHeadersMap(r.Header)
+// ResponseHeadersHandler sets every query parameter as a response header,
+// repeated keys become multi-valued headers. The headers are returned in the
+// body as well, including the final Content-Length.
+func ResponseHeadersHandler(w http.ResponseWriter, r *http.Request) {
+	// 压缩会去掉 Content-Length，导致响应体中的值不准确
+	middlewares.SkipCompression(w)
 
-	js, err := json.Marshal(headers)
-	if err != nil {
-		logger.InternalErrorPrint(w, err.Error())
-		return
+	header := w.Header()
+	query := r.URL.Query()
+	customType := false
+	for key := range query {
+		header.Del(key)
+		if http.CanonicalHeaderKey(key) == "Content-Type" {
+			customType = true
+		}
+	}
+	for key, values := range query {
+		for _, value := range values {
+			header.Add(key, value)
+		}
 	}
 
-	fmt.Fprintf(w, string(js))
-}
+	// Content-Length 的长度会影响响应体的长度，循环直到两者一致
+	var data []byte
+	for {
+		contentType, body, err := renderResult(r, getHeadersMap(header))
+		if err == errNotAcceptable {
+			header.Del("Content-Length")
+			writeNotAcceptable(w)
+			return
+		}
+		if err != nil {
+			logger.InternalErrorPrint(w, err.Error())
+			return
+		}
+		// 请求中指定的 Content-Type 优先
+		if !customType {
+			header.Set("Content-Type", contentType)
+		}
+		data = body
 
-func GetHandler(w http.ResponseWriter, r *http.Request) {
-	// TODO 写一个功能函数，统一获取相应内容，类似于 py 中的 get_dict
-	result := make(map[string]interface{})
-	queryArgs, err := getQueryArgs(r)
-	if err != nil {
-		logger.InternalErrorPrint(w, err.Error())
-		return
+		contentLength := strconv.Itoa(len(data))
+		if header.Get("Content-Length") == contentLength {
+			break
+		}
+		header.Set("Content-Length", contentLength)
 	}
 
-	result["origin"] = getPeerIP(r)
-	result["url"] = fmt.Sprintf("%s://%s%s", getRequestScheme(r), r.Host, r.URL.RequestURI())
-	result["headers"] = getHeadersMap(r.Header)
-	result["args"] = queryArgs
+	w.Write(data)
+}
 
-	// TODO 中间件统一写返回值的代码
-	js, err := json.Marshal(result)
-	if err != nil {
-		logger.InternalErrorPrint(w, err.Error())
-		return
-	}
+func HeadersHandler(w http.ResponseWriter, r *http.Request) {
+	writeResult(w, r, getHeadersMap(r.Header))
+}
+
+func GetHandler(w http.ResponseWriter, r *http.Request) {
+	writeDict(w, r, dictURL, dictArgs, dictHeaders, dictOrigin)
+}
 
-	fmt.Fprintf(w, string(js))
+// bodyHandler returns the request data together with the parsed body,
+// it's shared by the /delete, /post, /put and /patch endpoints.
+func bodyHandler(w http.ResponseWriter, r *http.Request) {
+	writeDict(w, r, dictURL, dictArgs, dictForm, dictData, dictOrigin, dictHeaders, dictFiles, dictJSON)
 }
 
 func DeleteHandler(w http.ResponseWriter, r *http.Request) {
-	result := make(map[string]interface{})
-	queryArgs, err := getQueryArgs(r)
-	if err != nil {
-		logger.InternalErrorPrint(w, err.Error())
-		return
-	}
+	bodyHandler(w, r)
+}
 
-	result["url"] = fmt.Sprintf("%s://%s%s", getRequestScheme(r), r.Host, r.URL.RequestURI())
-	result["args"] = queryArgs
-	result["origin"] = getPeerIP(r)
-	result["headers"] = getHeadersMap(r.Header)
+func PostHandler(w http.ResponseWriter, r *http.Request) {
+	bodyHandler(w, r)
+}
 
-	js, err := json.Marshal(result)
-	if err != nil {
-		logger.InternalErrorPrint(w, err.Error())
-		return
-	}
+func PutHandler(w http.ResponseWriter, r *http.Request) {
+	bodyHandler(w, r)
+}
+
+func PatchHandler(w http.ResponseWriter, r *http.Request) {
+	bodyHandler(w, r)
+}
 
-	fmt.Fprintf(w, string(js))
+// AnythingHandler returns anything that is passed to request, it accepts every method.
+func AnythingHandler(w http.ResponseWriter, r *http.Request) {
+	writeDict(w, r, dictURL, dictArgs, dictHeaders, dictOrigin, dictMethod, dictForm, dictData, dictFiles, dictJSON)
 }
 
 func BytesHandler(w http.ResponseWriter, r *http.Request) {
@@ -188,12 +284,12 @@ func BytesHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	n, err := strconv.ParseInt(vars["n"], 10, 64)
-	if err != nil {
-		logger.Println("INVALID path component", err)
+	if err != nil || n < 0 {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid number of bytes %s", vars["n"]))
 		return
 	}
-	if n > 100*1024 {
-		n = 100 * 1024
+	if n > MAX_BYTES {
+		n = MAX_BYTES
 	}
 
 	data := make([]byte, n)
@@ -238,10 +334,11 @@ func StreamBytesHandler(w http.ResponseWriter, r *http.Request) {
 
 	n, err := strconv.ParseInt(vars["n"], 10, 64)
 	if err != nil {
-		logger.Println("INVALID path component", vars["n"], err)
-		n = 100 * chunkSize
-	} else if n > 100*chunkSize {
-		n = 100 * chunkSize
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid number of bytes %s", vars["n"]))
+		return
+	}
+	if n > MAX_STREAM_BYTES {
+		n = MAX_STREAM_BYTES
 	}
 
 	filename := r.FormValue("filename")
@@ -275,6 +372,363 @@ func StreamBytesHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// StreamHandler streams n newline-delimited JSON request descriptions, n is capped at 100.
+func StreamHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		logger.InternalErrorPrint(w, "Excepted http.ResponseWriter to be a http.Flusher")
+		return
+	}
+
+	vars := mux.Vars(r)
+	if vars == nil {
+		logger.Println("INVALID PATH")
+		return
+	}
+
+	n, err := strconv.Atoi(vars["n"])
+	if err != nil || n < 0 {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid stream lines %s", vars["n"]))
+		return
+	}
+	if n > 100 {
+		n = 100
+	}
+
+	result, err := getDict(r, dictURL, dictArgs, dictHeaders, dictOrigin)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	for i := 0; i < n; i++ {
+		result["id"] = i
+		js, err := json.Marshal(result)
+		if err != nil {
+			logger.Println(err)
+			return
+		}
+
+		w.Write(append(js, '\n'))
+		flusher.Flush()
+	}
+}
+
+const (
+	// maxDelay 是 /delay 和 /drip 的最大等待时间
+	maxDelay = 10 * time.Second
+	// maxDripBytes 是 /drip 最多返回的字节数
+	maxDripBytes = 10 * 1024 * 1024
+	// dripMinInterval 是 /drip 两次写入之间的最小间隔，避免字节数很多时频繁 sleep
+	dripMinInterval = 10 * time.Millisecond
+)
+
+// sleepContext waits for d, it returns false if the request is canceled before.
+func sleepContext(r *http.Request, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+// DelayHandler returns the request data after n seconds, n is capped at 10 seconds.
+func DelayHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars == nil {
+		logger.Println("INVALID PATH")
+		return
+	}
+
+	delay, err := parseSeconds(vars["n"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid delay %s", vars["n"]))
+		return
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+
+	if !sleepContext(r, delay) {
+		logger.Println("Request canceled while delaying", r.URL)
+		return
+	}
+
+	writeDict(w, r, dictURL, dictArgs, dictForm, dictData, dictOrigin, dictHeaders, dictFiles)
+}
+
+// DripHandler drips numbytes bytes over duration seconds after an initial delay,
+// with the given status code.
+func DripHandler(w http.ResponseWriter, r *http.Request) {
+	// duration 和 delay 都不能超过 maxDelay，避免一个请求长时间占用连接
+	duration, err := parseSecondsDefault(r.FormValue("duration"), 2*time.Second)
+	if err != nil || duration > maxDelay {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid duration %s, excepted at most %s", r.FormValue("duration"), maxDelay))
+		return
+	}
+	delay, err := parseSecondsDefault(r.FormValue("delay"), 0)
+	if err != nil || delay > maxDelay {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid delay %s, excepted at most %s", r.FormValue("delay"), maxDelay))
+		return
+	}
+
+	numbytes := int64(10)
+	if numbytesRaw := r.FormValue("numbytes"); numbytesRaw != "" {
+		numbytes, err = strconv.ParseInt(numbytesRaw, 10, 64)
+		if err != nil || numbytes <= 0 {
+			writeError(w, http.StatusBadRequest, "number of bytes must be positive")
+			return
+		}
+	}
+	if numbytes > maxDripBytes {
+		numbytes = maxDripBytes
+	}
+
+	code := http.StatusOK
+	if codeRaw := r.FormValue("code"); codeRaw != "" {
+		code, err = strconv.Atoi(codeRaw)
+		if err != nil || code < 200 || code > 599 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid status code %s", codeRaw))
+			return
+		}
+	}
+
+	if delay > 0 && !sleepContext(r, delay) {
+		return
+	}
+
+	// 字节数太多时按 dripMinInterval 分批写入
+	chunks := numbytes
+	if maxChunks := int64(duration / dripMinInterval); maxChunks < chunks {
+		chunks = maxChunks
+	}
+	if chunks < 1 {
+		chunks = 1
+	}
+	pause := duration / time.Duration(chunks)
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(numbytes, 10))
+	w.WriteHeader(code)
+
+	flusher, _ := w.(http.Flusher)
+	for i := int64(0); i < chunks; i++ {
+		size := numbytes / chunks
+		if i < numbytes%chunks {
+			size++
+		}
+		w.Write(bytes.Repeat([]byte("*"), int(size)))
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		if i < chunks-1 && !sleepContext(r, pause) {
+			return
+		}
+	}
+}
+
+// writeCompressedDict writes the request description compressed with encoding
+// regardless of Accept-Encoding, flag is set to true in the result.
+func writeCompressedDict(w http.ResponseWriter, r *http.Request, encoding string, flag string) {
+	result, err := getDict(r, dictOrigin, dictHeaders, dictMethod)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	result[flag] = true
+
+	contentType, data, err := renderResult(r, result)
+	if err == errNotAcceptable {
+		writeNotAcceptable(w)
+		return
+	}
+	if err != nil {
+		logger.InternalErrorPrint(w, err.Error())
+		return
+	}
+
+	var buf bytes.Buffer
+	encoder, err := middlewares.NewEncoder(encoding, &buf)
+	if err != nil {
+		logger.InternalErrorPrint(w, err.Error())
+		return
+	}
+	encoder.Write(data)
+	encoder.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Encoding", encoding)
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.Write(buf.Bytes())
+}
+
+func GzipHandler(w http.ResponseWriter, r *http.Request) {
+	writeCompressedDict(w, r, "gzip", "gzipped")
+}
+
+func DeflateHandler(w http.ResponseWriter, r *http.Request) {
+	writeCompressedDict(w, r, "deflate", "deflated")
+}
+
+func BrotliHandler(w http.ResponseWriter, r *http.Request) {
+	writeCompressedDict(w, r, "br", "brotli")
+}
+
+// maxRangeBytes 是 /range 资源的最大字节数
+const maxRangeBytes = 100 * 1024
+
+// writeRangeBytes writes bytes [start, start+length) of the /range resource,
+// chunk by chunk, sleeping pausePerByte for every written byte.
+// It returns false if the request is canceled.
+func writeRangeBytes(w io.Writer, flusher http.Flusher, r *http.Request, br byteRange, chunkSize int64, pausePerByte time.Duration) bool {
+	if chunkSize > br.length {
+		chunkSize = br.length
+	}
+	chunk := make([]byte, 0, chunkSize)
+	end := br.start + br.length
+	for i := br.start; i < end; i++ {
+		// 资源内容在多次请求间保持不变
+		chunk = append(chunk, byte('a'+i%26))
+		if int64(len(chunk)) == chunkSize || i == end-1 {
+			if _, err := w.Write(chunk); err != nil {
+				return false
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+			if pausePerByte > 0 && !sleepContext(r, pausePerByte*time.Duration(len(chunk))) {
+				return false
+			}
+			chunk = chunk[:0]
+		}
+	}
+
+	return true
+}
+
+type countingWriter int64
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	*w += countingWriter(len(p))
+	return len(p), nil
+}
+
+func writeMultipartRanges(w io.Writer, boundary string, ranges []byteRange, size int64, write func(io.Writer, byteRange) bool) {
+	mw := multipart.NewWriter(w)
+	mw.SetBoundary(boundary)
+	for _, br := range ranges {
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":  {"application/octet-stream"},
+			"Content-Range": {br.contentRange(size)},
+		})
+		if err != nil || !write(part, br) {
+			return
+		}
+	}
+	mw.Close()
+}
+
+// RangeHandler streams numbytes deterministic bytes and honors single and
+// multiple ranges of the Range header. chunk_size and duration control how
+// fast the bytes are sent.
+func RangeHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars == nil {
+		logger.Println("INVALID PATH")
+		return
+	}
+
+	header := w.Header()
+	header.Set("Accept-Ranges", "bytes")
+
+	numbytes, err := strconv.ParseInt(vars["numbytes"], 10, 64)
+	if err != nil || numbytes <= 0 || numbytes > maxRangeBytes {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("number of bytes must be in the range (0, %d]", maxRangeBytes))
+		return
+	}
+	etag := fmt.Sprintf(`"range%d"`, numbytes)
+	header.Set("ETag", etag)
+
+	chunkSize := int64(10 * 1024)
+	if chunkSizeRaw := r.FormValue("chunk_size"); chunkSizeRaw != "" {
+		chunkSize, err = strconv.ParseInt(chunkSizeRaw, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid chunk_size %s", chunkSizeRaw))
+			return
+		}
+		// chunk_size 用于分配缓冲区，限制在 [1, numbytes] 之间
+		if chunkSize < 1 {
+			chunkSize = 1
+		} else if chunkSize > numbytes {
+			chunkSize = numbytes
+		}
+	}
+	duration, err := parseSecondsDefault(r.FormValue("duration"), 0)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid duration %s", r.FormValue("duration")))
+		return
+	}
+	pausePerByte := duration / time.Duration(numbytes)
+
+	// If-Range 不匹配时忽略 Range，返回完整内容
+	rangeHeader := r.Header.Get("Range")
+	if ifRange := r.Header.Get("If-Range"); ifRange != "" && ifRange != etag {
+		rangeHeader = ""
+	}
+	ranges, err := parseRange(rangeHeader, numbytes)
+	if err != nil {
+		header.Del("Content-Type")
+		header.Set("Content-Range", fmt.Sprintf("bytes */%d", numbytes))
+		header.Set("Content-Length", "0")
+		w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+	write := func(w io.Writer, br byteRange) bool {
+		return writeRangeBytes(w, flusher, r, br, chunkSize, pausePerByte)
+	}
+
+	switch len(ranges) {
+	case 0:
+		header.Set("Content-Type", "application/octet-stream")
+		header.Set("Content-Length", strconv.FormatInt(numbytes, 10))
+		w.WriteHeader(http.StatusOK)
+		if r.Method != http.MethodHead {
+			write(w, byteRange{start: 0, length: numbytes})
+		}
+	case 1:
+		header.Set("Content-Type", "application/octet-stream")
+		header.Set("Content-Range", ranges[0].contentRange(numbytes))
+		header.Set("Content-Length", strconv.FormatInt(ranges[0].length, 10))
+		w.WriteHeader(http.StatusPartialContent)
+		if r.Method != http.MethodHead {
+			write(w, ranges[0])
+		}
+	default:
+		boundary := multipart.NewWriter(nil).Boundary()
+
+		// 先计算 multipart 的长度，用于设置 Content-Length
+		var size countingWriter
+		writeMultipartRanges(&size, boundary, ranges, numbytes, func(w io.Writer, br byteRange) bool {
+			size += countingWriter(br.length)
+			return true
+		})
+
+		header.Set("Content-Type", "multipart/byteranges; boundary="+boundary)
+		header.Set("Content-Length", strconv.FormatInt(int64(size), 10))
+		w.WriteHeader(http.StatusPartialContent)
+		if r.Method != http.MethodHead {
+			writeMultipartRanges(w, boundary, ranges, numbytes, write)
+		}
+	}
+}
+
 func BasicAuthHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	if vars == nil {
@@ -286,24 +740,258 @@ func BasicAuthHandler(w http.ResponseWriter, r *http.Request) {
 
 	if !checkBasicAuth(r, user, passwd) {
 		w.Header().Set("WWW-Authenticate", `Basic realm="Fake Realm"`)
-		http.Error(w, "Incorrect User or Password", http.StatusUnauthorized)
+		writeError(w, http.StatusUnauthorized, "Incorrect User or Password")
+		return
+	}
+
+	writeResult(w, r, map[string]interface{}{
+		"authenticated": true,
+		"user":          user,
+	})
+}
+
+// HiddenBasicAuthHandler works like BasicAuthHandler, but returns 404 instead of 401 on failure.
+func HiddenBasicAuthHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars == nil {
+		logger.Println("INVALID PATH")
+		return
+	}
+	user := vars["user"]
+	passwd := vars["passwd"]
+
+	if !checkBasicAuth(r, user, passwd) {
+		http.NotFound(w, r)
+		return
+	}
+
+	writeResult(w, r, map[string]interface{}{
+		"authenticated": true,
+		"user":          user,
+	})
+}
+
+func BearerHandler(w http.ResponseWriter, r *http.Request) {
+	token, ok := checkBearerAuth(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, "Missing Bearer Token")
+		return
+	}
+
+	writeResult(w, r, map[string]interface{}{
+		"authenticated": true,
+		"token":         token,
+	})
+}
+
+// JWTHandler returns the header and claims of the token verified by the JWT middleware.
+func JWTHandler(w http.ResponseWriter, r *http.Request) {
+	token, ok := middlewares.JWTFromContext(r.Context())
+	if !ok {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, "Missing Bearer Token")
+		return
+	}
+
+	writeResult(w, r, token)
+}
+
+func digestChallengeResponse(w http.ResponseWriter, qop, algorithm string, stale bool, cookies map[string]string) {
+	for name, value := range cookies {
+		http.SetCookie(w, &http.Cookie{Name: name, Value: value, Path: "/"})
+	}
+	w.Header().Set("WWW-Authenticate", digestChallenge(qop, algorithm, stale))
+	writeError(w, http.StatusUnauthorized, "Incorrect User or Password")
+}
+
+// DigestAuthHandler challenges HTTP Digest Auth. The optional algorithm may be
+// MD5, SHA-256 or SHA-512-256, stale_after is the number of requests after
+// which the nonce is reported as stale.
+func DigestAuthHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars == nil {
+		logger.Println("INVALID PATH")
 		return
 	}
+	user := vars["user"]
+	passwd := vars["passwd"]
+
+	qop := vars["qop"]
+	if qop != "auth" && qop != "auth-int" {
+		qop = ""
+	}
+	algorithm := strings.ToUpper(vars["algorithm"])
+	if _, ok := digestAlgorithms[algorithm]; !ok {
+		algorithm = "MD5"
+	}
+	staleAfter := vars["stale_after"]
+	if staleAfter == "" {
+		staleAfter = "never"
+	}
 
-	js, err := json.Marshal(map[string]interface{}{
+	credentials, ok := parseDigestAuthorization(r.Header.Get("Authorization"))
+	if !ok {
+		digestChallengeResponse(w, qop, algorithm, false, map[string]string{
+			"stale_after": staleAfter,
+			"fake":        "fake_value",
+		})
+		return
+	}
+
+	currentNonce := credentials["nonce"]
+	staleAfterValue := ""
+	if cookie, err := r.Cookie("stale_after"); err == nil {
+		staleAfterValue = cookie.Value
+	}
+	lastNonce, err := r.Cookie("last_nonce")
+	if (err == nil && lastNonce.Value == currentNonce) || staleAfterValue == "0" {
+		digestChallengeResponse(w, qop, algorithm, true, map[string]string{
+			"stale_after": staleAfter,
+			"last_nonce":  currentNonce,
+			"fake":        "fake_value",
+		})
+		return
+	}
+
+	ok, err = checkDigestAuth(r, credentials, user, passwd, qop, algorithm)
+	if err == errBodyTooLarge {
+		writeError(w, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	}
+	if !ok {
+		digestChallengeResponse(w, qop, algorithm, false, map[string]string{
+			"stale_after": staleAfter,
+			"last_nonce":  currentNonce,
+			"fake":        "fake_value",
+		})
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: "fake", Value: "fake_value", Path: "/"})
+	if staleAfterValue != "" {
+		http.SetCookie(w, &http.Cookie{Name: "stale_after", Value: nextStaleAfter(staleAfterValue), Path: "/"})
+	}
+
+	writeResult(w, r, map[string]interface{}{
 		"authenticated": true,
 		"user":          user,
 	})
+}
+
+const teapotASCIIArt = `
+    -=[ teapot ]=-
+
+       _...._
+     .'  _ _ '.
+    | ."  ^  ". _,
+    \_;'"---"'|//
+      |       ;/
+      \_     _/
+        """""
+`
+
+// StatusHandler returns the status code given in the path. Several codes
+// separated by commas may be given, optionally weighted like "200:0.7,500:0.3",
+// one of them is chosen randomly. The optional seed parameter makes the
+// choice reproducible.
+func StatusHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars == nil {
+		logger.Println("INVALID PATH")
+		return
+	}
+
+	choices, err := parseStatusCodes(vars["codes"])
 	if err != nil {
-		logger.Fatalln(err)
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	randGenerator := rand.New(rand.NewSource(time.Now().UnixNano()))
+	seedRaw := r.FormValue("seed")
+	if seedRaw != "" {
+		seed, err := strconv.ParseInt(seedRaw, 10, 64)
+		if err == nil {
+			randGenerator = rand.New(rand.NewSource(seed))
+		} else {
+			logger.Printf("INVALID SEED %s %s", seedRaw, err)
+		}
+	}
+	code := chooseStatusCode(choices, randGenerator)
+
+	header := w.Header()
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusUseProxy, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		header.Set("Location", "/redirect/1")
+		w.WriteHeader(code)
+	case http.StatusNoContent, http.StatusNotModified:
+		// 204 和 304 不能有响应体
+		header.Del("Content-Type")
+		w.WriteHeader(code)
+	case http.StatusUnauthorized:
+		header.Set("WWW-Authenticate", `Basic realm="Fake Realm"`)
+		w.WriteHeader(code)
+	case http.StatusPaymentRequired:
+		header.Set("Content-Type", "text/plain; charset=utf-8")
+		header.Set("X-More-Info", "http://vimeo.com/22053820")
+		w.WriteHeader(code)
+		w.Write([]byte("Payment required"))
+	case http.StatusNotAcceptable:
+		writeJSON(w, code, map[string]interface{}{
+			"message": "Client did not request a supported media type.",
+			"accept":  []string{"image/webp", "image/svg+xml", "image/jpeg", "image/png", "image/*"},
+		})
+	case http.StatusProxyAuthRequired:
+		header.Set("Proxy-Authenticate", `Basic realm="Fake Realm"`)
+		w.WriteHeader(code)
+	case http.StatusTeapot:
+		header.Set("Content-Type", "text/plain; charset=utf-8")
+		header.Set("X-More-Info", "http://tools.ietf.org/html/rfc2324")
+		w.WriteHeader(code)
+		w.Write([]byte(teapotASCIIArt))
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		retryAfter := r.FormValue("retry_after")
+		if _, err := strconv.Atoi(retryAfter); err != nil {
+			retryAfter = "1"
+		}
+		header.Set("Retry-After", retryAfter)
+		w.WriteHeader(code)
+	default:
+		w.WriteHeader(code)
 	}
+}
 
-	fmt.Fprint(w, string(js))
+// redirectStatusCodes 是 /redirect-to 接受的 status_code 参数
+var redirectStatusCodes = map[int]bool{
+	http.StatusMovedPermanently:  true,
+	http.StatusFound:             true,
+	http.StatusSeeOther:          true,
+	http.StatusTemporaryRedirect: true,
+	http.StatusPermanentRedirect: true,
 }
 
 func redirectToHandler(w http.ResponseWriter, r *http.Request, url string) {
+	// 检查的地址和 Location 中发送的地址保持一致
+	url = strings.TrimSpace(url)
+	if err := REDIRECT_POLICY.Check(url); err != nil {
+		writeError(w, http.StatusForbidden, fmt.Sprintf("%s: %s", err, url))
+		return
+	}
+
+	statusCode := http.StatusFound
+	if statusCodeRaw := r.FormValue("status_code"); statusCodeRaw != "" {
+		code, err := strconv.Atoi(statusCodeRaw)
+		if err != nil || !redirectStatusCodes[code] {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid status_code %s, excepted one of 301, 302, 303, 307, 308", statusCodeRaw))
+			return
+		}
+		statusCode = code
+	}
+
 	w.Header().Set("Location", url)
-	w.WriteHeader(http.StatusFound)
+	w.WriteHeader(statusCode)
 }
 
 func RedirectToGetHandler(w http.ResponseWriter, r *http.Request) {
@@ -325,6 +1013,50 @@ func RedirectToFormHandler(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
+// redirectNTimes redirects to /{kind}-redirect/{n-1}, the last hop goes to /get.
+func redirectNTimes(w http.ResponseWriter, r *http.Request, kind string, absolute bool) {
+	vars := mux.Vars(r)
+	if vars == nil {
+		logger.Println("INVALID PATH")
+		return
+	}
+
+	n, err := strconv.Atoi(vars["n"])
+	if err != nil || n < 1 {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid redirect times %s", vars["n"]))
+		return
+	}
+
+	location := "/get"
+	if n > 1 {
+		location = fmt.Sprintf("/%s-redirect/%d", kind, n-1)
+	}
+	if absolute {
+		location = getBaseURL(r) + location
+	}
+
+	w.Header().Set("Location", location)
+	w.WriteHeader(http.StatusFound)
+}
+
+// RedirectHandler 302 redirects n times, the Location headers are absolute
+// URLs when the absolute parameter is true.
+func RedirectHandler(w http.ResponseWriter, r *http.Request) {
+	if strings.ToLower(r.FormValue("absolute")) == "true" {
+		redirectNTimes(w, r, "absolute", true)
+	} else {
+		redirectNTimes(w, r, "relative", false)
+	}
+}
+
+func RelativeRedirectHandler(w http.ResponseWriter, r *http.Request) {
+	redirectNTimes(w, r, "relative", false)
+}
+
+func AbsoluteRedirectHandler(w http.ResponseWriter, r *http.Request) {
+	redirectNTimes(w, r, "absolute", true)
+}
+
 /*
  * ====================================
  * WebApp Init
@@ -337,7 +1069,14 @@ func GetMux() *mux.Router {
 	var imgRouter = router.NewRoute().Subrouter()
 
 	// 注册中间件
+	if len(ENABLED_GROUPS) > 0 {
+		router.Use(groupMiddleware)
+	}
 	registerMiddleware(apiRouter)
+	registerJWTMiddleware(router, map[string]*mux.Router{
+		"api":   apiRouter,
+		"image": imgRouter,
+	})
 
 	// 注册API接口
 	apiRouter.HandleFunc("/legacy", IndexHandler).Methods(http.MethodGet, http.MethodHead)
@@ -345,18 +1084,65 @@ func GetMux() *mux.Router {
 	apiRouter.HandleFunc("/uuid", UUIDHandler).Methods(http.MethodGet, http.MethodHead)
 	apiRouter.HandleFunc("/user-agent", UserAgentHandler).Methods(http.MethodGet, http.MethodHead)
 	apiRouter.HandleFunc("/headers", HeadersHandler).Methods(http.MethodGet, http.MethodHead)
+	apiRouter.HandleFunc("/tls", TLSHandler).Methods(http.MethodGet, http.MethodHead)
+	apiRouter.HandleFunc("/response-headers", ResponseHeadersHandler).Methods(http.MethodGet, http.MethodHead, http.MethodPost)
 
 	apiRouter.HandleFunc("/get", GetHandler).Methods(http.MethodGet, http.MethodHead)
 	apiRouter.HandleFunc("/delete", DeleteHandler).Methods(http.MethodDelete)
+	apiRouter.HandleFunc("/post", PostHandler).Methods(http.MethodPost)
+	apiRouter.HandleFunc("/put", PutHandler).Methods(http.MethodPut)
+	apiRouter.HandleFunc("/patch", PatchHandler).Methods(http.MethodPatch)
+
+	// 不限制请求方法，自定义的方法也可以访问
+	apiRouter.HandleFunc("/anything", AnythingHandler)
+	apiRouter.HandleFunc("/anything/{path:.*}", AnythingHandler)
+
+	apiRouter.HandleFunc("/html", HTMLHandler).Methods(http.MethodGet, http.MethodHead)
+	apiRouter.HandleFunc("/xml", XMLHandler).Methods(http.MethodGet, http.MethodHead)
+	apiRouter.HandleFunc("/json", JSONHandler).Methods(http.MethodGet, http.MethodHead)
+	apiRouter.HandleFunc("/robots.txt", RobotsHandler).Methods(http.MethodGet, http.MethodHead)
+	apiRouter.HandleFunc("/deny", DenyHandler).Methods(http.MethodGet, http.MethodHead)
+	apiRouter.HandleFunc("/encoding/utf8", UTF8Handler).Methods(http.MethodGet, http.MethodHead)
+	apiRouter.HandleFunc("/gzip", GzipHandler).Methods(http.MethodGet, http.MethodHead)
+	apiRouter.HandleFunc("/deflate", DeflateHandler).Methods(http.MethodGet, http.MethodHead)
+	apiRouter.HandleFunc("/brotli", BrotliHandler).Methods(http.MethodGet, http.MethodHead)
 
 	apiRouter.HandleFunc("/base64/{value}", Base64Handler).Methods(http.MethodGet, http.MethodHead)
 	apiRouter.HandleFunc("/bytes/{n}", BytesHandler).Methods(http.MethodGet, http.MethodHead)
+	apiRouter.HandleFunc("/range/{numbytes}", RangeHandler).Methods(http.MethodGet, http.MethodHead)
+	apiRouter.HandleFunc("/links/{n}", LinksHandler).Methods(http.MethodGet, http.MethodHead)
+	apiRouter.HandleFunc("/links/{n}/{offset}", LinksPageHandler).Methods(http.MethodGet, http.MethodHead)
+	apiRouter.HandleFunc("/stream/{n}", StreamHandler).Methods(http.MethodGet, http.MethodHead)
 	apiRouter.HandleFunc("/stream-bytes/{n}", StreamBytesHandler).Methods(http.MethodGet, http.MethodHead)
+	apiRouter.HandleFunc("/delay/{n}", DelayHandler)
+	apiRouter.HandleFunc("/drip", DripHandler).Methods(http.MethodGet, http.MethodHead)
 	apiRouter.HandleFunc("/basic-auth/{user}/{passwd}", BasicAuthHandler).Methods(http.MethodGet, http.MethodHead)
+	apiRouter.HandleFunc("/hidden-basic-auth/{user}/{passwd}", HiddenBasicAuthHandler).Methods(http.MethodGet, http.MethodHead)
+	apiRouter.HandleFunc("/bearer", BearerHandler).Methods(http.MethodGet, http.MethodHead)
+	apiRouter.HandleFunc("/digest-auth/{qop}/{user}/{passwd}", DigestAuthHandler)
+	apiRouter.HandleFunc("/digest-auth/{qop}/{user}/{passwd}/{algorithm}", DigestAuthHandler)
+	apiRouter.HandleFunc("/digest-auth/{qop}/{user}/{passwd}/{algorithm}/{stale_after}", DigestAuthHandler)
+
+	// Status codes
+	apiRouter.HandleFunc("/status/{codes}", StatusHandler)
 
 	// Redirects
 	apiRouter.HandleFunc("/redirect-to", RedirectToGetHandler).Methods(http.MethodGet, http.MethodHead).Queries("url", "{url:.+}")
 	apiRouter.HandleFunc("/redirect-to", RedirectToFormHandler).Methods(http.MethodPut, http.MethodPatch, http.MethodPost)
+	apiRouter.HandleFunc("/redirect/{n}", RedirectHandler).Methods(http.MethodGet, http.MethodHead)
+	apiRouter.HandleFunc("/relative-redirect/{n}", RelativeRedirectHandler).Methods(http.MethodGet, http.MethodHead)
+	apiRouter.HandleFunc("/absolute-redirect/{n}", AbsoluteRedirectHandler).Methods(http.MethodGet, http.MethodHead)
+
+	// Cache
+	apiRouter.HandleFunc("/cache", CacheHandler).Methods(http.MethodGet, http.MethodHead)
+	apiRouter.HandleFunc("/cache/{n}", CacheControlHandler).Methods(http.MethodGet, http.MethodHead)
+	apiRouter.HandleFunc("/etag/{etag}", ETagHandler).Methods(http.MethodGet, http.MethodHead)
+
+	// Cookies
+	apiRouter.HandleFunc("/cookies", CookiesHandler).Methods(http.MethodGet, http.MethodHead)
+	apiRouter.HandleFunc("/cookies/set", SetCookiesHandler).Methods(http.MethodGet, http.MethodHead)
+	apiRouter.HandleFunc("/cookies/set/{name}/{value}", SetCookieHandler).Methods(http.MethodGet, http.MethodHead)
+	apiRouter.HandleFunc("/cookies/delete", DeleteCookiesHandler).Methods(http.MethodGet, http.MethodHead)
 
 	// Images
 	imgRouter.HandleFunc("/image", ImgHandler).Methods(http.MethodGet, http.MethodHead)
@@ -368,14 +1154,45 @@ func GetMux() *mux.Router {
 
 	// 注册静态文件
 	router.PathPrefix("/static").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir(STATIC_DIR))))
-	router.PathPrefix("/").Handler(http.FileServer(http.Dir("./static/swaggerui/dist")))
+	router.PathPrefix("/").Handler(http.FileServer(http.Dir(filepath.Join(STATIC_DIR, "swaggerui", "dist"))))
 
 	return router
 }
 
+// groupMiddleware responds 404 to the endpoints of the groups which are not in ENABLED_GROUPS.
+func groupMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route := mux.CurrentRoute(r); route != nil {
+			if template, err := route.GetPathTemplate(); err == nil && !groupEnabled(groupOf(template)) {
+				http.NotFound(w, r)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 func registerMiddleware(router *mux.Router) {
-	// TODO: 实现 JWT 认证
-	//awm := middlewares.NewAuthMiddleware()
-	//router.Use(awm.Middleware)
 	router.Use(middlewares.JSONMiddleware)
+	router.Use(middlewares.CompressMiddleware)
+}
+
+// registerJWTMiddleware registers the /jwt endpoint and protects the route
+// groups listed in JWT_GROUPS, it does nothing when JWT is not configured.
+func registerJWTMiddleware(router *mux.Router, groups map[string]*mux.Router) {
+	if JWT_MIDDLEWARE == nil {
+		return
+	}
+
+	for _, name := range JWT_GROUPS {
+		group, ok := groups[name]
+		if !ok {
+			logger.Fatalf("Unknown route group %q, excepted one of api, image", name)
+		}
+		group.Use(JWT_MIDDLEWARE.Middleware)
+	}
+
+	jwtRouter := router.NewRoute().Subrouter()
+	jwtRouter.Use(middlewares.JSONMiddleware, JWT_MIDDLEWARE.Middleware)
+	jwtRouter.HandleFunc("/jwt", JWTHandler).Methods(http.MethodGet, http.MethodHead)
 }
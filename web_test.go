@@ -1,14 +1,44 @@
 package httpbin_test
 
 import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"encoding/xml"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
+	"math/big"
+	"mime"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/andybalholm/brotli"
 	"github.com/bwangelme/go-httpbin"
+	"github.com/bwangelme/go-httpbin/middlewares"
 	"github.com/gorilla/mux"
+	"github.com/vmihailenco/msgpack/v5"
+	"gopkg.in/yaml.v2"
 )
 
 func TestIPHandler(t *testing.T) {
@@ -33,6 +63,183 @@ func TestIPHandler(t *testing.T) {
 	}
 }
 
+func TestProxyPolicy(t *testing.T) {
+	networks, err := httpbin.ParseTrustedProxies([]string{"10.0.0.0/8", "::1"})
+	if err != nil {
+		log.Fatalln(err)
+	}
+	httpbin.PROXY_POLICY.TrustedProxies = networks
+	defer func() { httpbin.PROXY_POLICY = httpbin.ProxyPolicy{} }()
+
+	cases := []struct {
+		clientHeader string
+		remoteAddr   string
+		header       map[string]string
+		ip           string
+		hops         []string
+	}{
+		{"", "203.0.113.9:4000", map[string]string{"X-Forwarded-For": "1.2.3.4"}, "203.0.113.9", []string{"203.0.113.9"}},
+		{"", "10.0.0.1:4000", nil, "10.0.0.1", []string{"10.0.0.1"}},
+		{"", "10.0.0.1:4000", map[string]string{"X-Forwarded-For": "1.2.3.4, 198.51.100.7, 10.0.0.2"}, "198.51.100.7", []string{"1.2.3.4", "198.51.100.7", "10.0.0.2", "10.0.0.1"}},
+		{"", "10.0.0.1:4000", map[string]string{"Forwarded": "for=6.6.6.6", "X-Forwarded-For": "198.51.100.7"}, "198.51.100.7", []string{"198.51.100.7", "10.0.0.1"}},
+		{"", "10.0.0.1:4000", map[string]string{"X-Forwarded-For": "1.2.3.4, garbage"}, "10.0.0.1", []string{"1.2.3.4", "garbage", "10.0.0.1"}},
+		{"x-real-ip", "[::1]:4000", map[string]string{"X-Real-IP": "198.51.100.7:5555", "X-Forwarded-For": "6.6.6.6"}, "198.51.100.7", []string{"198.51.100.7", "::1"}},
+		{"Forwarded", "10.0.0.1:4000", map[string]string{"Forwarded": `for=192.0.2.60;proto=https, for="[2001:db8::1]:4711";by=10.0.0.1`, "X-Forwarded-For": "1.2.3.4"}, "2001:db8::1", []string{"192.0.2.60", "2001:db8::1", "10.0.0.1"}},
+		{"Forwarded", "10.0.0.1:4000", map[string]string{"Forwarded": "for=unknown"}, "10.0.0.1", []string{"unknown", "10.0.0.1"}},
+	}
+
+	for _, c := range cases {
+		httpbin.PROXY_POLICY.ClientHeader = c.clientHeader
+		req, err := http.NewRequest("GET", "/ip?hops", nil)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		req.RemoteAddr = c.remoteAddr
+		for key, value := range c.header {
+			req.Header.Set(key, value)
+		}
+
+		record := httptest.NewRecorder()
+		httpbin.GetMux().ServeHTTP(record, req)
+
+		var result struct {
+			IP   string
+			Hops []string
+		}
+		if err := json.Unmarshal(record.Body.Bytes(), &result); err != nil {
+			log.Fatalln(err)
+		}
+		if result.IP != c.ip || fmt.Sprint(result.Hops) != fmt.Sprint(c.hops) {
+			log.Fatalf("Unexcepted result %v for %s %v, excepted %s %v\n", result, c.remoteAddr, c.header, c.ip, c.hops)
+		}
+	}
+
+	if _, err := httpbin.ParseProxyHeader("X-Client-IP"); err == nil {
+		log.Fatalln("Excepted error for invalid proxy header")
+	}
+	if _, err := httpbin.ParseTrustedProxies([]string{"10.0.0.0/33"}); err == nil {
+		log.Fatalln("Excepted error for invalid trusted proxy")
+	}
+}
+
+func TestForwardedURL(t *testing.T) {
+	networks, err := httpbin.ParseTrustedProxies([]string{"10.0.0.0/8"})
+	if err != nil {
+		log.Fatalln(err)
+	}
+	httpbin.PROXY_POLICY.TrustedProxies = networks
+	defer func() { httpbin.PROXY_POLICY = httpbin.ProxyPolicy{} }()
+
+	cases := []struct {
+		clientHeader string
+		remoteAddr   string
+		header       map[string]string
+		url          string
+	}{
+		{"", "203.0.113.9:4000", map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "evil.com"}, "http://localhost/get?a=1"},
+		{"", "10.0.0.1:4000", map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "example.com", "X-Forwarded-Prefix": "/httpbin/"}, "https://example.com/httpbin/get?a=1"},
+		{"", "10.0.0.1:4000", map[string]string{"X-Forwarded-Proto": "HTTPS, http", "X-Forwarded-Host": "evil.com, real.example.com"}, "http://real.example.com/get?a=1"},
+		{"", "10.0.0.1:4000", map[string]string{"Forwarded": `proto=https;host="evil.com"`, "X-Forwarded-Proto": "http"}, "http://localhost/get?a=1"},
+		{"Forwarded", "10.0.0.1:4000", map[string]string{"Forwarded": `proto=http;host=evil.com, proto=https;host="example.com:8443"`, "X-Forwarded-Proto": "http"}, "https://example.com:8443/get?a=1"},
+		{"", "10.0.0.1:4000", map[string]string{"X-Forwarded-Proto": "javascript", "X-Forwarded-Host": "evil.com/x", "X-Forwarded-Prefix": "//evil.com"}, "http://localhost/get?a=1"},
+	}
+
+	for _, c := range cases {
+		httpbin.PROXY_POLICY.ClientHeader = c.clientHeader
+		req, err := http.NewRequest("GET", "http://localhost/get?a=1", nil)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		req.RemoteAddr = c.remoteAddr
+		for key, value := range c.header {
+			req.Header.Set(key, value)
+		}
+
+		record := httptest.NewRecorder()
+		httpbin.GetMux().ServeHTTP(record, req)
+
+		var result struct {
+			URL string
+		}
+		if err := json.Unmarshal(record.Body.Bytes(), &result); err != nil {
+			log.Fatalln(err)
+		}
+		if result.URL != c.url {
+			log.Fatalf("Unexcepted url %s for %s %v, excepted %s\n", result.URL, c.remoteAddr, c.header, c.url)
+		}
+	}
+}
+
+func TestTLSHandler(t *testing.T) {
+	req, err := http.NewRequest("GET", "/tls", nil)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	record := httptest.NewRecorder()
+	httpbin.GetMux().ServeHTTP(record, req)
+	if record.Code != http.StatusBadRequest {
+		log.Fatalf("Excepted 400 without TLS, got %d\n", record.Code)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "tester"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"client.test"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	req.TLS = &tls.ConnectionState{
+		Version:            tls.VersionTLS13,
+		CipherSuite:        tls.TLS_AES_128_GCM_SHA256,
+		NegotiatedProtocol: "h2",
+		ServerName:         "localhost",
+		PeerCertificates:   []*x509.Certificate{cert},
+		VerifiedChains:     [][]*x509.Certificate{{cert}},
+	}
+	record = httptest.NewRecorder()
+	httpbin.GetMux().ServeHTTP(record, req)
+
+	var result struct {
+		Version            string
+		CipherSuite        string `json:"cipher_suite"`
+		ALPN               string
+		ServerName         string `json:"server_name"`
+		ClientVerified     bool   `json:"client_verified"`
+		ClientCertificates []struct {
+			Subject           string
+			DNSNames          []string `json:"dns_names"`
+			SHA256Fingerprint string   `json:"sha256_fingerprint"`
+		} `json:"client_certificates"`
+	}
+	if err := json.Unmarshal(record.Body.Bytes(), &result); err != nil {
+		log.Fatalln(err)
+	}
+
+	fingerprint := sha256.Sum256(der)
+	if result.Version != "TLS 1.3" || result.CipherSuite != "TLS_AES_128_GCM_SHA256" || result.ALPN != "h2" ||
+		result.ServerName != "localhost" || !result.ClientVerified || len(result.ClientCertificates) != 1 {
+		log.Fatalf("Unexcepted TLS info %s\n", record.Body.String())
+	}
+	clientCert := result.ClientCertificates[0]
+	if clientCert.Subject != "CN=tester" || fmt.Sprint(clientCert.DNSNames) != "[client.test]" ||
+		clientCert.SHA256Fingerprint != hex.EncodeToString(fingerprint[:]) {
+		log.Fatalf("Unexcepted client certificate %v\n", clientCert)
+	}
+}
+
 func TestBase64Handler(t *testing.T) {
 	originTest := "hello world\n"
 	base64EncodedVal := "aGVsbG8gd29ybGQK"
@@ -59,6 +266,1175 @@ func TestBase64Handler(t *testing.T) {
 	}
 }
 
+func TestResponseWriter(t *testing.T) {
+	req, err := http.NewRequest("GET", "/headers?pretty", nil)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	req.Header.Set("X-Progress", "100%d")
+
+	record := httptest.NewRecorder()
+	httpbin.GetMux().ServeHTTP(record, req)
+
+	body := record.Body.String()
+	if !strings.Contains(body, `"X-Progress": "100%d"`) {
+		log.Fatalf("Excepted indented header value 100%%d, got %s\n", body)
+	}
+	if record.Header().Get("Content-Length") != fmt.Sprint(len(body)) {
+		log.Fatalf("Unexcepted Content-Length %s for %d bytes\n", record.Header().Get("Content-Length"), len(body))
+	}
+
+	errorCases := []struct {
+		path string
+		code int
+	}{
+		{"/base64/not-base64!", http.StatusBadRequest},
+		{"/links/x/0", http.StatusBadRequest},
+		{"/delay/x", http.StatusBadRequest},
+		{"/range/0", http.StatusNotFound},
+		{"/cache/x", http.StatusBadRequest},
+		{"/bytes/abc", http.StatusBadRequest},
+		{"/bytes/-1", http.StatusBadRequest},
+		{"/drip?duration=11", http.StatusBadRequest},
+		{"/drip?delay=3600", http.StatusBadRequest},
+		{"/stream-bytes/abc", http.StatusBadRequest},
+		{"/basic-auth/user/passwd", http.StatusUnauthorized},
+	}
+	for _, c := range errorCases {
+		req, err = http.NewRequest("GET", c.path, nil)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		record = httptest.NewRecorder()
+		httpbin.GetMux().ServeHTTP(record, req)
+
+		var result struct {
+			Status  int
+			Error   string
+			Message string
+		}
+		if err := json.Unmarshal(record.Body.Bytes(), &result); err != nil || record.Header().Get("Content-Type") != "application/json" {
+			log.Fatalf("Excepted JSON error body for %s, got %s\n", c.path, record.Body.String())
+		}
+		if record.Code != c.code || result.Status != c.code || result.Error != http.StatusText(c.code) || result.Message == "" {
+			log.Fatalf("Unexcepted error response for %s: %d %v\n", c.path, record.Code, result)
+		}
+	}
+}
+
+func TestGetHandlerMultiValues(t *testing.T) {
+	req, err := http.NewRequest("GET", "/get?a=1&a=2&b=3", nil)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	req.Header.Add("X-Test", "first")
+	req.Header.Add("X-Test", "second")
+
+	record := httptest.NewRecorder()
+	httpbin.GetMux().ServeHTTP(record, req)
+
+	var result struct {
+		Args    map[string]interface{}
+		Headers map[string]interface{}
+	}
+	if err := json.Unmarshal(record.Body.Bytes(), &result); err != nil {
+		log.Fatalln(err)
+	}
+	if fmt.Sprint(result.Args["a"]) != "[1 2]" || result.Args["b"] != "3" {
+		log.Fatalf("Unexcepted args %v\n", result.Args)
+	}
+	if fmt.Sprint(result.Headers["X-Test"]) != "[first second]" {
+		log.Fatalf("Unexcepted headers %v\n", result.Headers)
+	}
+}
+
+func TestContentNegotiation(t *testing.T) {
+	tests := []struct {
+		url         string
+		accept      string
+		contentType string
+		unmarshal   func([]byte, interface{}) error
+	}{
+		{"/get?a=1", "", "application/json", json.Unmarshal},
+		{"/get?a=1", "application/x-yaml", "application/x-yaml", yaml.Unmarshal},
+		{"/get?a=1", "text/xml;q=0.5, application/json;q=0.1", "application/xml", xml.Unmarshal},
+		{"/get?a=1", "application/msgpack", "application/msgpack", msgpack.Unmarshal},
+		{"/get?a=1", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", "application/json", json.Unmarshal},
+		{"/get?a=1", "application/xml;q=0.9, application/json", "application/json", json.Unmarshal},
+		{"/get?a=1", "application/x-yaml, */*;q=0.1", "application/x-yaml", yaml.Unmarshal},
+		{"/get?a=1&format=yaml", "application/json", "application/x-yaml", yaml.Unmarshal},
+		{"/get?a=1&format=pretty", "", "application/json", json.Unmarshal},
+	}
+
+	for _, test := range tests {
+		req, err := http.NewRequest("GET", test.url, nil)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if test.accept != "" {
+			req.Header.Set("Accept", test.accept)
+		}
+
+		record := httptest.NewRecorder()
+		httpbin.GetMux().ServeHTTP(record, req)
+
+		if record.Code != 200 || record.Header().Get("Content-Type") != test.contentType {
+			log.Fatalf("Unexcepted response %d %s for %s\n", record.Code, record.Header().Get("Content-Type"), test.url)
+		}
+
+		var result struct {
+			Args struct {
+				A string `json:"a" yaml:"a" xml:"a" msgpack:"a"`
+			} `json:"args" yaml:"args" xml:"args" msgpack:"args"`
+		}
+		if err := test.unmarshal(record.Body.Bytes(), &result); err != nil {
+			log.Fatalf("Unmarshal %s response: %s\n", test.contentType, err)
+		}
+		if result.Args.A != "1" {
+			log.Fatalf("Unexcepted args %q in %s response\n", result.Args.A, test.contentType)
+		}
+	}
+
+	req, err := http.NewRequest("GET", "/get?a=1&format=pretty", nil)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	record := httptest.NewRecorder()
+	httpbin.GetMux().ServeHTTP(record, req)
+	if !strings.Contains(record.Body.String(), "\n  \"") {
+		log.Fatalf("Excepted indented JSON, got %s\n", record.Body.String())
+	}
+
+	for url, accept := range map[string]string{
+		"/get":            "text/csv",
+		"/get?format=csv": "",
+		"/ip":             "application/json;q=0, text/html",
+	} {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+
+		record := httptest.NewRecorder()
+		httpbin.GetMux().ServeHTTP(record, req)
+		if record.Code != http.StatusNotAcceptable {
+			log.Fatalf("Excepted 406 for %s, got %d\n", url, record.Code)
+		}
+	}
+}
+
+func TestPostHandler(t *testing.T) {
+	router := httpbin.GetMux()
+
+	// urlencoded 表单
+	req, err := http.NewRequest("POST", "/post?a=1", strings.NewReader("name=httpbin&lang=go"))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	record := httptest.NewRecorder()
+	router.ServeHTTP(record, req)
+
+	var result map[string]interface{}
+	if err := json.Unmarshal(record.Body.Bytes(), &result); err != nil {
+		log.Fatalln(err)
+	}
+	form := result["form"].(map[string]interface{})
+	if form["name"] != "httpbin" || form["lang"] != "go" {
+		log.Fatalf("Unexcepted form %v\n", form)
+	}
+	if args := result["args"].(map[string]interface{}); args["a"] != "1" {
+		log.Fatalf("Unexcepted args %v\n", args)
+	}
+
+	// JSON
+	req, err = http.NewRequest("POST", "/post", strings.NewReader(`{"key": "value"}`))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	record = httptest.NewRecorder()
+	router.ServeHTTP(record, req)
+
+	result = nil
+	if err := json.Unmarshal(record.Body.Bytes(), &result); err != nil {
+		log.Fatalln(err)
+	}
+	if result["data"] != `{"key": "value"}` {
+		log.Fatalf("Unexcepted data %v\n", result["data"])
+	}
+	if js := result["json"].(map[string]interface{}); js["key"] != "value" {
+		log.Fatalf("Unexcepted json %v\n", js)
+	}
+}
+
+func TestPutHandlerMultipart(t *testing.T) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	writer.WriteField("name", "httpbin")
+	part, err := writer.CreateFormFile("file", "hello.txt")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	part.Write([]byte("hello world"))
+	writer.Close()
+
+	req, err := http.NewRequest("PUT", "/put", &buf)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	record := httptest.NewRecorder()
+	httpbin.GetMux().ServeHTTP(record, req)
+
+	if status := record.Code; status != http.StatusOK {
+		log.Fatalf("Error code %v, excepted %v\n", status, http.StatusOK)
+	}
+
+	var result map[string]interface{}
+	if err := json.Unmarshal(record.Body.Bytes(), &result); err != nil {
+		log.Fatalln(err)
+	}
+	if form := result["form"].(map[string]interface{}); form["name"] != "httpbin" {
+		log.Fatalf("Unexcepted form %v\n", form)
+	}
+	if files := result["files"].(map[string]interface{}); files["file"] != "hello world" {
+		log.Fatalf("Unexcepted files %v\n", files)
+	}
+}
+
+func TestAnythingHandler(t *testing.T) {
+	router := httpbin.GetMux()
+
+	for _, method := range []string{"GET", "POST", "OPTIONS", "PURGE"} {
+		req, err := http.NewRequest(method, "/anything/foo/bar?a=1", strings.NewReader("data"))
+		if err != nil {
+			log.Fatalln(err)
+		}
+		record := httptest.NewRecorder()
+		router.ServeHTTP(record, req)
+
+		if status := record.Code; status != http.StatusOK {
+			log.Fatalf("Error code %v, excepted %v\n", status, http.StatusOK)
+		}
+
+		var result map[string]interface{}
+		if err := json.Unmarshal(record.Body.Bytes(), &result); err != nil {
+			log.Fatalln(err)
+		}
+		if result["method"] != method {
+			log.Fatalf("Unexcepted method %v, excepted %v\n", result["method"], method)
+		}
+		if result["data"] != "data" {
+			log.Fatalf("Unexcepted data %v\n", result["data"])
+		}
+	}
+}
+
+func TestStatusHandler(t *testing.T) {
+	router := httpbin.GetMux()
+
+	cases := []struct {
+		path   string
+		code   int
+		header string
+		value  string
+	}{
+		{"/status/418", http.StatusTeapot, "X-More-Info", "http://tools.ietf.org/html/rfc2324"},
+		{"/status/302", http.StatusFound, "Location", "/redirect/1"},
+		{"/status/401", http.StatusUnauthorized, "WWW-Authenticate", `Basic realm="Fake Realm"`},
+		{"/status/503?retry_after=5", http.StatusServiceUnavailable, "Retry-After", "5"},
+		{"/status/200:0,500:1", http.StatusInternalServerError, "", ""},
+		{"/status/abc", http.StatusBadRequest, "", ""},
+	}
+	for _, c := range cases {
+		req, err := http.NewRequest("POST", c.path, nil)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		record := httptest.NewRecorder()
+		router.ServeHTTP(record, req)
+
+		if record.Code != c.code {
+			log.Fatalf("%s: Error code %v, excepted %v\n", c.path, record.Code, c.code)
+		}
+		if c.header != "" && record.Header().Get(c.header) != c.value {
+			log.Fatalf("%s: Unexcepted header %s: %s\n", c.path, c.header, record.Header().Get(c.header))
+		}
+	}
+
+	// 相同的 seed 总是返回相同的状态码
+	var codes []int
+	for i := 0; i < 3; i++ {
+		req, err := http.NewRequest("GET", "/status/200:0.5,500:0.5?seed=42", nil)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		record := httptest.NewRecorder()
+		router.ServeHTTP(record, req)
+		codes = append(codes, record.Code)
+	}
+	if codes[0] != codes[1] || codes[1] != codes[2] {
+		log.Fatalf("Unexcepted codes with the same seed %v\n", codes)
+	}
+}
+
+func TestBearerHandler(t *testing.T) {
+	router := httpbin.GetMux()
+
+	req, err := http.NewRequest("GET", "/bearer", nil)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	record := httptest.NewRecorder()
+	router.ServeHTTP(record, req)
+	if record.Code != http.StatusUnauthorized || record.Header().Get("WWW-Authenticate") != "Bearer" {
+		log.Fatalf("Error code %v, excepted %v\n", record.Code, http.StatusUnauthorized)
+	}
+
+	req.Header.Set("Authorization", "Bearer abcdef")
+	record = httptest.NewRecorder()
+	router.ServeHTTP(record, req)
+	expectedBody := `{"authenticated":true,"token":"abcdef"}`
+	if actualBody := record.Body.String(); actualBody != expectedBody {
+		log.Fatalf("Unexcepted body %s, excepted body %s\n", actualBody, expectedBody)
+	}
+}
+
+func TestHiddenBasicAuthHandler(t *testing.T) {
+	router := httpbin.GetMux()
+
+	req, err := http.NewRequest("GET", "/hidden-basic-auth/user/passwd", nil)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	req.SetBasicAuth("user", "wrong")
+	record := httptest.NewRecorder()
+	router.ServeHTTP(record, req)
+	if record.Code != http.StatusNotFound {
+		log.Fatalf("Error code %v, excepted %v\n", record.Code, http.StatusNotFound)
+	}
+
+	req.SetBasicAuth("user", "passwd")
+	record = httptest.NewRecorder()
+	router.ServeHTTP(record, req)
+	if record.Code != http.StatusOK {
+		log.Fatalf("Error code %v, excepted %v\n", record.Code, http.StatusOK)
+	}
+}
+
+func signJWT(alg string, claims map[string]interface{}, sign func([]byte) []byte) string {
+	header, _ := json.Marshal(map[string]interface{}{"alg": alg, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(signed)))
+}
+
+func TestJWTHandler(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	keyFile, err := ioutil.TempFile("", "*.pem")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	pem.Encode(keyFile, &pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	keyFile.Close()
+
+	jwtm, err := middlewares.NewJWTMiddleware(middlewares.JWTConfig{
+		KeyFile:  keyFile.Name(),
+		Audience: "go-httpbin",
+	})
+	if err != nil {
+		log.Fatalln(err)
+	}
+	httpbin.JWT_MIDDLEWARE = jwtm
+	defer func() { httpbin.JWT_MIDDLEWARE = nil }()
+	router := httpbin.GetMux()
+
+	es256 := func(signed []byte) []byte {
+		digest := sha256.Sum256(signed)
+		r, s, err := ecdsa.Sign(rand.Reader, ecKey, digest[:])
+		if err != nil {
+			log.Fatalln(err)
+		}
+		sig := make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+		return sig
+	}
+	hs256 := func(signed []byte) []byte {
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write(signed)
+		return mac.Sum(nil)
+	}
+
+	cases := []struct {
+		token string
+		code  int
+	}{
+		{signJWT("ES256", map[string]interface{}{"sub": "user", "aud": "go-httpbin"}, es256), http.StatusOK},
+		{signJWT("ES256", map[string]interface{}{"sub": "user", "aud": "other"}, es256), http.StatusUnauthorized},
+		{signJWT("ES256", map[string]interface{}{"sub": "user", "aud": "go-httpbin", "exp": 1}, es256), http.StatusUnauthorized},
+		{signJWT("ES256", map[string]interface{}{"sub": "user", "aud": "go-httpbin", "exp": "never"}, es256), http.StatusUnauthorized},
+		{signJWT("HS256", map[string]interface{}{"sub": "user", "aud": "go-httpbin"}, hs256), http.StatusUnauthorized},
+		{"", http.StatusUnauthorized},
+	}
+	for i, c := range cases {
+		req, err := http.NewRequest("GET", "/jwt", nil)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		record := httptest.NewRecorder()
+		router.ServeHTTP(record, req)
+
+		if record.Code != c.code {
+			log.Fatalf("case %d: Error code %v, excepted %v %s\n", i, record.Code, c.code, record.Body.String())
+		}
+		if c.code == http.StatusOK && !strings.Contains(record.Body.String(), `"sub":"user"`) {
+			log.Fatalf("Unexcepted body %s\n", record.Body.String())
+		}
+	}
+
+	// HS256 密钥只能通过 SecretFile 指定，无法识别的密钥文件直接报错
+	secretFile, err := ioutil.TempFile("", "*.secret")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	secretFile.WriteString("secret\n")
+	secretFile.Close()
+
+	if _, err := middlewares.NewJWTMiddleware(middlewares.JWTConfig{KeyFile: secretFile.Name()}); err == nil {
+		log.Fatalln("Excepted error for unrecognized key file")
+	}
+	jwtm, err = middlewares.NewJWTMiddleware(middlewares.JWTConfig{SecretFile: secretFile.Name()})
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if _, err := jwtm.Verify(signJWT("HS256", map[string]interface{}{"sub": "user"}, hs256), time.Now()); err != nil {
+		log.Fatalf("Unexcepted error %s\n", err)
+	}
+}
+
+func TestDigestAuthHandler(t *testing.T) {
+	router := httpbin.GetMux()
+	sha256Hex := func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	md5Hex := func(s string) string {
+		sum := md5.Sum([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+
+	cases := []struct {
+		path      string
+		algorithm string
+		qop       string
+		body      string
+		h         func(string) string
+	}{
+		{"/digest-auth/auth/user/passwd", "MD5", "auth", "", md5Hex},
+		{"/digest-auth/auth-int/user/passwd/SHA-256", "SHA-256", "auth-int", "hello", sha256Hex},
+	}
+	for _, c := range cases {
+		req, err := http.NewRequest("POST", c.path, strings.NewReader(c.body))
+		if err != nil {
+			log.Fatalln(err)
+		}
+		record := httptest.NewRecorder()
+		router.ServeHTTP(record, req)
+
+		challenge := record.Header().Get("WWW-Authenticate")
+		if record.Code != http.StatusUnauthorized || !strings.Contains(challenge, "algorithm="+c.algorithm) {
+			log.Fatalf("Unexcepted challenge %v %s\n", record.Code, challenge)
+		}
+		nonce := regexp.MustCompile(`nonce="(\w+)"`).FindStringSubmatch(challenge)[1]
+
+		ha1 := c.h("user:go-httpbin:passwd")
+		ha2 := c.h("POST:" + c.path)
+		if c.qop == "auth-int" {
+			ha2 = c.h("POST:" + c.path + ":" + c.h(c.body))
+		}
+		response := c.h(strings.Join([]string{ha1, nonce, "00000001", "0a4f113b", c.qop, ha2}, ":"))
+
+		req, err = http.NewRequest("POST", c.path, strings.NewReader(c.body))
+		if err != nil {
+			log.Fatalln(err)
+		}
+		req.Header.Set("Authorization", fmt.Sprintf(
+			`Digest username="user", realm="go-httpbin", nonce="%s", uri="%s", algorithm=%s, qop=%s, nc=00000001, cnonce="0a4f113b", response="%s"`,
+			nonce, c.path, c.algorithm, c.qop, response))
+		record = httptest.NewRecorder()
+		router.ServeHTTP(record, req)
+		if record.Code != http.StatusOK {
+			log.Fatalf("%s: Error code %v, excepted %v\n", c.path, record.Code, http.StatusOK)
+		}
+
+		// stale_after 为 0 时 nonce 过期
+		req.AddCookie(&http.Cookie{Name: "stale_after", Value: "0"})
+		record = httptest.NewRecorder()
+		router.ServeHTTP(record, req)
+		if record.Code != http.StatusUnauthorized || !strings.Contains(record.Header().Get("WWW-Authenticate"), "stale=TRUE") {
+			log.Fatalf("Excepted stale challenge, got %v %s\n", record.Code, record.Header().Get("WWW-Authenticate"))
+		}
+	}
+
+	// 为一个地址计算的响应不能用于其他地址
+	path := "/digest-auth/auth/user/passwd"
+	ha1 := md5Hex("user:go-httpbin:passwd")
+	response := md5Hex(strings.Join([]string{ha1, "abc", "00000001", "0a4f113b", "auth", md5Hex("GET:" + path)}, ":"))
+	req, err := http.NewRequest("GET", path+"/MD5", nil)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf(
+		`Digest username="user", realm="go-httpbin", nonce="abc", uri="%s", qop=auth, nc=00000001, cnonce="0a4f113b", response="%s"`,
+		path, response))
+	record := httptest.NewRecorder()
+	router.ServeHTTP(record, req)
+	if record.Code != http.StatusUnauthorized {
+		log.Fatalf("Error code %v, excepted %v\n", record.Code, http.StatusUnauthorized)
+	}
+
+	// 可信代理去掉了 X-Forwarded-Prefix，客户端计算响应时使用带前缀的地址
+	networks, err := httpbin.ParseTrustedProxies([]string{"10.0.0.0/8"})
+	if err != nil {
+		log.Fatalln(err)
+	}
+	httpbin.PROXY_POLICY.TrustedProxies = networks
+	defer func() { httpbin.PROXY_POLICY = httpbin.ProxyPolicy{} }()
+
+	response = md5Hex(strings.Join([]string{ha1, "abc", "00000001", "0a4f113b", "auth", md5Hex("GET:/httpbin" + path)}, ":"))
+	for remoteAddr, code := range map[string]int{"10.0.0.1:4000": http.StatusOK, "203.0.113.9:4000": http.StatusUnauthorized} {
+		req, err = http.NewRequest("GET", path, nil)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-Prefix", "/httpbin")
+		req.Header.Set("Authorization", fmt.Sprintf(
+			`Digest username="user", realm="go-httpbin", nonce="abc", uri="/httpbin%s", qop=auth, nc=00000001, cnonce="0a4f113b", response="%s"`,
+			path, response))
+		record = httptest.NewRecorder()
+		router.ServeHTTP(record, req)
+		if record.Code != code {
+			log.Fatalf("%s: Error code %v, excepted %v\n", remoteAddr, record.Code, code)
+		}
+	}
+}
+
+func TestRedirectHandler(t *testing.T) {
+	router := httpbin.GetMux()
+
+	cases := []struct {
+		path     string
+		code     int
+		location string
+	}{
+		{"/redirect/3", http.StatusFound, "/relative-redirect/2"},
+		{"/redirect/3?absolute=true", http.StatusFound, "http://example.com/absolute-redirect/2"},
+		{"/relative-redirect/1", http.StatusFound, "/get"},
+		{"/absolute-redirect/2", http.StatusFound, "http://example.com/absolute-redirect/1"},
+		{"/redirect/0", http.StatusBadRequest, ""},
+		{"/redirect-to?url=/get&status_code=307", http.StatusTemporaryRedirect, "/get"},
+		{"/redirect-to?url=/get&status_code=200", http.StatusBadRequest, ""},
+	}
+	for _, c := range cases {
+		req, err := http.NewRequest("GET", "http://example.com"+c.path, nil)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		record := httptest.NewRecorder()
+		router.ServeHTTP(record, req)
+
+		if record.Code != c.code {
+			log.Fatalf("%s: Error code %v, excepted %v\n", c.path, record.Code, c.code)
+		}
+		if location := record.Header().Get("Location"); location != c.location {
+			log.Fatalf("%s: Unexcepted location %s, excepted %s\n", c.path, location, c.location)
+		}
+	}
+}
+
+func TestRedirectPolicy(t *testing.T) {
+	router := httpbin.GetMux()
+	defer func() { httpbin.REDIRECT_POLICY = httpbin.RedirectPolicy{} }()
+
+	cases := []struct {
+		policy httpbin.RedirectPolicy
+		target string
+		code   int
+	}{
+		{httpbin.RedirectPolicy{}, "http://evil.com/", http.StatusFound},
+		{httpbin.RedirectPolicy{RelativeOnly: true}, "/get", http.StatusFound},
+		{httpbin.RedirectPolicy{RelativeOnly: true}, "//evil.com/", http.StatusForbidden},
+		{httpbin.RedirectPolicy{RelativeOnly: true}, `/\evil.com/`, http.StatusForbidden},
+		{httpbin.RedirectPolicy{RelativeOnly: true}, "///evil.com/", http.StatusForbidden},
+		{httpbin.RedirectPolicy{RelativeOnly: true}, "////evil.com", http.StatusForbidden},
+		{httpbin.RedirectPolicy{RelativeOnly: true}, `/\evil.com`, http.StatusForbidden},
+		{httpbin.RedirectPolicy{AllowedHosts: []string{"example.com"}}, "///evil.com/", http.StatusForbidden},
+		{httpbin.RedirectPolicy{AllowedHosts: []string{"example.com"}}, `/\/evil.com`, http.StatusForbidden},
+		{httpbin.RedirectPolicy{AllowedHosts: []string{"example.com"}}, "///example.com/", http.StatusFound},
+		{httpbin.RedirectPolicy{DeniedHosts: []string{"evil.com"}}, "////evil.com", http.StatusForbidden},
+		{httpbin.RedirectPolicy{RelativeOnly: true}, "%20//evil.com/", http.StatusForbidden},
+		{httpbin.RedirectPolicy{AllowedHosts: []string{"*.example.com"}}, "%20//evil.com/", http.StatusForbidden},
+		{httpbin.RedirectPolicy{AllowedHosts: []string{"*.example.com"}}, "https://www.example.com/", http.StatusFound},
+		{httpbin.RedirectPolicy{AllowedHosts: []string{"*.example.com"}}, "https://evil.com/", http.StatusForbidden},
+		{httpbin.RedirectPolicy{AllowedHosts: []string{"*.example.com"}}, "javascript:alert(1)", http.StatusForbidden},
+		{httpbin.RedirectPolicy{DeniedHosts: []string{"evil.com"}}, "http://EVIL.com:8080/", http.StatusForbidden},
+		{httpbin.RedirectPolicy{DeniedHosts: []string{"evil.com"}}, "http://example.com/", http.StatusFound},
+		{httpbin.RedirectPolicy{DeniedHosts: []string{"evil.com"}}, "http:///evil.com/", http.StatusForbidden},
+		{httpbin.RedirectPolicy{DeniedHosts: []string{"evil.com"}}, "https:evil.com", http.StatusForbidden},
+	}
+	for _, c := range cases {
+		httpbin.REDIRECT_POLICY = c.policy
+		req, err := http.NewRequest("POST", "/redirect-to", strings.NewReader("url="+c.target))
+		if err != nil {
+			log.Fatalln(err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		record := httptest.NewRecorder()
+		router.ServeHTTP(record, req)
+
+		if record.Code != c.code {
+			log.Fatalf("%s: Error code %v, excepted %v\n", c.target, record.Code, c.code)
+		}
+		if c.code == http.StatusForbidden && !strings.Contains(record.Body.String(), `"error"`) {
+			log.Fatalf("Unexcepted body %s\n", record.Body.String())
+		}
+	}
+}
+
+func TestDelayHandler(t *testing.T) {
+	router := httpbin.GetMux()
+
+	req, err := http.NewRequest("GET", "/delay/0.05?a=1", nil)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	record := httptest.NewRecorder()
+	start := time.Now()
+	router.ServeHTTP(record, req)
+	if record.Code != http.StatusOK || time.Since(start) < 50*time.Millisecond {
+		log.Fatalf("Error code %v, cost %v\n", record.Code, time.Since(start))
+	}
+
+	// 请求被取消后立即返回
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, err = http.NewRequest("GET", "/delay/10", nil)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	record = httptest.NewRecorder()
+	start = time.Now()
+	router.ServeHTTP(record, req.WithContext(ctx))
+	if time.Since(start) > time.Second {
+		log.Fatalf("Canceled request cost %v\n", time.Since(start))
+	}
+}
+
+func TestDripHandler(t *testing.T) {
+	req, err := http.NewRequest("GET", "/drip?duration=0.1&numbytes=5&code=201&delay=0", nil)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	record := httptest.NewRecorder()
+	start := time.Now()
+	httpbin.GetMux().ServeHTTP(record, req)
+
+	if record.Code != http.StatusCreated {
+		log.Fatalf("Error code %v, excepted %v\n", record.Code, http.StatusCreated)
+	}
+	if body := record.Body.String(); body != "*****" {
+		log.Fatalf("Unexcepted body %s\n", body)
+	}
+	if time.Since(start) < 80*time.Millisecond {
+		log.Fatalf("Drip finished too fast %v\n", time.Since(start))
+	}
+}
+
+func TestStreamHandler(t *testing.T) {
+	req, err := http.NewRequest("GET", "/stream/3?a=1", nil)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	record := httptest.NewRecorder()
+	httpbin.GetMux().ServeHTTP(record, req)
+
+	lines := strings.Split(strings.TrimSuffix(record.Body.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		log.Fatalf("Unexcepted lines %d, excepted 3\n", len(lines))
+	}
+	for i, line := range lines {
+		var result map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &result); err != nil {
+			log.Fatalln(err)
+		}
+		if result["id"] != float64(i) {
+			log.Fatalf("Unexcepted id %v, excepted %d\n", result["id"], i)
+		}
+		if args := result["args"].(map[string]interface{}); args["a"] != "1" {
+			log.Fatalf("Unexcepted args %v\n", args)
+		}
+	}
+}
+
+func TestRangeHandler(t *testing.T) {
+	router := httpbin.GetMux()
+	serve := func(rangeHeader, ifRange string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", "/range/30", nil)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		if ifRange != "" {
+			req.Header.Set("If-Range", ifRange)
+		}
+		record := httptest.NewRecorder()
+		router.ServeHTTP(record, req)
+		return record
+	}
+
+	record := serve("", "")
+	if record.Code != http.StatusOK || record.Body.String() != "abcdefghijklmnopqrstuvwxyzabcd" {
+		log.Fatalf("Unexcepted response %v %s\n", record.Code, record.Body.String())
+	}
+	if record.Header().Get("ETag") != `"range30"` || record.Header().Get("Accept-Ranges") != "bytes" {
+		log.Fatalf("Unexcepted headers %v\n", record.Header())
+	}
+
+	record = serve("bytes=2-4", "")
+	if record.Code != http.StatusPartialContent || record.Body.String() != "cde" || record.Header().Get("Content-Range") != "bytes 2-4/30" {
+		log.Fatalf("Unexcepted response %v %s %v\n", record.Code, record.Body.String(), record.Header())
+	}
+
+	record = serve("bytes=-3", `"range30"`)
+	if record.Code != http.StatusPartialContent || record.Body.String() != "bcd" {
+		log.Fatalf("Unexcepted response %v %s\n", record.Code, record.Body.String())
+	}
+
+	record = serve("bytes=-3", `"other"`)
+	if record.Code != http.StatusOK {
+		log.Fatalf("Error code %v, excepted %v\n", record.Code, http.StatusOK)
+	}
+
+	record = serve("bytes=30-", "")
+	if record.Code != http.StatusRequestedRangeNotSatisfiable || record.Header().Get("Content-Range") != "bytes */30" {
+		log.Fatalf("Unexcepted response %v %v\n", record.Code, record.Header())
+	}
+
+	record = serve("bytes=0-1,26-", "")
+	mediaType, params, err := mime.ParseMediaType(record.Header().Get("Content-Type"))
+	if err != nil || record.Code != http.StatusPartialContent || mediaType != "multipart/byteranges" {
+		log.Fatalf("Unexcepted response %v %v\n", record.Code, record.Header())
+	}
+	if record.Header().Get("Content-Length") != fmt.Sprint(record.Body.Len()) {
+		log.Fatalf("Unexcepted Content-Length %s, body length %d\n", record.Header().Get("Content-Length"), record.Body.Len())
+	}
+	reader := multipart.NewReader(record.Body, params["boundary"])
+	for _, excepted := range []string{"ab", "abcd"} {
+		part, err := reader.NextPart()
+		if err != nil {
+			log.Fatalln(err)
+		}
+		data, _ := ioutil.ReadAll(part)
+		if string(data) != excepted {
+			log.Fatalf("Unexcepted part %s, excepted %s\n", data, excepted)
+		}
+	}
+
+	// 重叠的范围超过资源大小时忽略 Range
+	record = serve("bytes=0-,0-,0-", "")
+	if record.Code != http.StatusOK || record.Body.Len() != 30 {
+		log.Fatalf("Unexcepted response %v, body length %d\n", record.Code, record.Body.Len())
+	}
+
+	req, err := http.NewRequest("GET", "/range/30?chunk_size=100000000000000", nil)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	record = httptest.NewRecorder()
+	router.ServeHTTP(record, req)
+	if record.Code != http.StatusOK || record.Body.Len() != 30 {
+		log.Fatalf("Unexcepted response %v, body length %d\n", record.Code, record.Body.Len())
+	}
+}
+
+func TestCompressHandlers(t *testing.T) {
+	router := httpbin.GetMux()
+
+	cases := []struct {
+		path   string
+		flag   string
+		reader func(io.Reader) (io.Reader, error)
+	}{
+		{"/gzip", "gzipped", func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }},
+		{"/deflate", "deflated", func(r io.Reader) (io.Reader, error) { return zlib.NewReader(r) }},
+		{"/brotli", "brotli", func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil }},
+	}
+	for _, c := range cases {
+		req, err := http.NewRequest("GET", c.path, nil)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		// 接口总是返回压缩后的内容，中间件不会重复压缩
+		req.Header.Set("Accept-Encoding", "gzip")
+		record := httptest.NewRecorder()
+		router.ServeHTTP(record, req)
+
+		reader, err := c.reader(record.Body)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		var result map[string]interface{}
+		if err := json.NewDecoder(reader).Decode(&result); err != nil {
+			log.Fatalf("%s: %s\n", c.path, err)
+		}
+		if result[c.flag] != true {
+			log.Fatalf("%s: Unexcepted result %v\n", c.path, result)
+		}
+	}
+}
+
+func TestCompressMiddleware(t *testing.T) {
+	router := httpbin.GetMux()
+
+	cases := []struct {
+		path           string
+		acceptEncoding string
+		encoding       string
+	}{
+		{"/get", "gzip, deflate, br", "br"},
+		{"/get", "gzip;q=1.0, br;q=0.5", "gzip"},
+		{"/get", "gzip;q=0, deflate;q=0.1", "deflate"},
+		{"/get", "*;q=0.5, br;q=0", "gzip"},
+		{"/get", "identity", ""},
+		{"/get", "", ""},
+		{"/bytes/100", "gzip", ""},
+		{"/status/200", "gzip", ""},
+		{"/redirect/2", "gzip", ""},
+		{"/basic-auth/user/passwd", "gzip", "gzip"},
+	}
+	for _, c := range cases {
+		req, err := http.NewRequest("GET", c.path, nil)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		req.Header.Set("Accept-Encoding", c.acceptEncoding)
+		record := httptest.NewRecorder()
+		router.ServeHTTP(record, req)
+
+		if encoding := record.Header().Get("Content-Encoding"); encoding != c.encoding {
+			log.Fatalf("%s %q: Unexcepted encoding %q, excepted %q\n", c.path, c.acceptEncoding, encoding, c.encoding)
+		}
+		if c.encoding == "" && (c.path == "/status/200" || c.path == "/redirect/2") && record.Body.Len() != 0 {
+			log.Fatalf("%s: Excepted empty body, got %d bytes\n", c.path, record.Body.Len())
+		}
+		if c.encoding == "gzip" {
+			reader, err := gzip.NewReader(record.Body)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			var result map[string]interface{}
+			if err := json.NewDecoder(reader).Decode(&result); err != nil {
+				log.Fatalln(err)
+			}
+		}
+	}
+}
+
+func TestCookiesHandlers(t *testing.T) {
+	router := httpbin.GetMux()
+	serve := func(path string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		record := httptest.NewRecorder()
+		router.ServeHTTP(record, req)
+		return record
+	}
+
+	record := serve("/cookies", &http.Cookie{Name: "k1", Value: "v1"})
+	if expectedBody := `{"cookies":{"k1":"v1"}}`; record.Body.String() != expectedBody {
+		log.Fatalf("Unexcepted body %s, excepted body %s\n", record.Body.String(), expectedBody)
+	}
+
+	record = serve("/cookies/set?k1=v1&secure=true&httponly=1&samesite=Strict&max_age=60&path=/cookies")
+	if record.Code != http.StatusFound || record.Header().Get("Location") != "/cookies" {
+		log.Fatalf("Unexcepted response %v %v\n", record.Code, record.Header())
+	}
+	setCookies := record.Result().Cookies()
+	if len(setCookies) != 1 {
+		log.Fatalf("Unexcepted cookies %v\n", setCookies)
+	}
+	cookie := setCookies[0]
+	if cookie.Name != "k1" || cookie.Value != "v1" || !cookie.Secure || !cookie.HttpOnly ||
+		cookie.SameSite != http.SameSiteStrictMode || cookie.MaxAge != 60 || cookie.Path != "/cookies" {
+		log.Fatalf("Unexcepted cookie %v\n", cookie)
+	}
+
+	record = serve("/cookies/set/k2/v2")
+	if setCookies = record.Result().Cookies(); len(setCookies) != 1 || setCookies[0].Value != "v2" {
+		log.Fatalf("Unexcepted cookies %v\n", setCookies)
+	}
+
+	record = serve("/cookies/delete?k1")
+	if setCookies = record.Result().Cookies(); len(setCookies) != 1 || setCookies[0].MaxAge >= 0 {
+		log.Fatalf("Unexcepted cookies %v\n", setCookies)
+	}
+
+	record = serve("/cookies/set?k1=v1&samesite=bad")
+	if record.Code != http.StatusBadRequest {
+		log.Fatalf("Error code %v, excepted %v\n", record.Code, http.StatusBadRequest)
+	}
+}
+
+func TestResponseHeadersHandler(t *testing.T) {
+	req, err := http.NewRequest("GET", "/response-headers?X-Test=1&X-Test=2&Server=httpbin", nil)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	req.Header.Set("Accept-Encoding", "gzip")
+	record := httptest.NewRecorder()
+	httpbin.GetMux().ServeHTTP(record, req)
+
+	if values := record.Header()["X-Test"]; len(values) != 2 || values[0] != "1" || values[1] != "2" {
+		log.Fatalf("Unexcepted header X-Test %v\n", values)
+	}
+	if record.Header().Get("Content-Length") != fmt.Sprint(record.Body.Len()) {
+		log.Fatalf("Unexcepted Content-Length %s, body length %d\n", record.Header().Get("Content-Length"), record.Body.Len())
+	}
+
+	var result map[string]interface{}
+	if err := json.Unmarshal(record.Body.Bytes(), &result); err != nil {
+		log.Fatalln(err)
+	}
+	if result["Server"] != "httpbin" || fmt.Sprint(result["X-Test"]) != "[1 2]" || result["Content-Length"] != fmt.Sprint(record.Body.Len()) {
+		log.Fatalf("Unexcepted body %v\n", result)
+	}
+
+	req, err = http.NewRequest("GET", "/response-headers?Content-Type=text/plain", nil)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	record = httptest.NewRecorder()
+	httpbin.GetMux().ServeHTTP(record, req)
+	if contentType := record.Header().Get("Content-Type"); contentType != "text/plain" {
+		log.Fatalf("Unexcepted Content-Type %s\n", contentType)
+	}
+}
+
+func TestCacheHandlers(t *testing.T) {
+	router := httpbin.GetMux()
+
+	cases := []struct {
+		path    string
+		headers map[string]string
+		code    int
+	}{
+		{"/cache", nil, http.StatusOK},
+		{"/cache", map[string]string{"If-Modified-Since": "Sat, 29 Oct 1994 19:43:31 GMT"}, http.StatusNotModified},
+		{"/cache", map[string]string{"If-None-Match": `"abc"`}, http.StatusNotModified},
+		{"/etag/abc", nil, http.StatusOK},
+		{"/etag/abc", map[string]string{"If-None-Match": `"xyz", W/"abc"`}, http.StatusNotModified},
+		{"/etag/abc", map[string]string{"If-None-Match": `"xyz"`}, http.StatusOK},
+		{"/etag/abc", map[string]string{"If-None-Match": `*`}, http.StatusNotModified},
+		{"/etag/abc", map[string]string{"If-Match": `"xyz", "abc"`}, http.StatusOK},
+		{"/etag/abc", map[string]string{"If-Match": `W/"abc"`}, http.StatusPreconditionFailed},
+		{"/etag/abc", map[string]string{"If-Match": `*`}, http.StatusOK},
+		{"/etag/abc", map[string]string{"If-None-Match": `"xyz"`, "If-Match": `"xyz"`}, http.StatusOK},
+	}
+	for _, c := range cases {
+		req, err := http.NewRequest("GET", c.path, nil)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		for k, v := range c.headers {
+			req.Header.Set(k, v)
+		}
+		record := httptest.NewRecorder()
+		router.ServeHTTP(record, req)
+
+		if record.Code != c.code {
+			log.Fatalf("%s %v: Error code %v, excepted %v\n", c.path, c.headers, record.Code, c.code)
+		}
+		if c.code == http.StatusNotModified && record.Body.Len() != 0 {
+			log.Fatalf("Unexcepted body %s\n", record.Body.String())
+		}
+	}
+
+	req, err := http.NewRequest("GET", "/cache/60", nil)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	record := httptest.NewRecorder()
+	router.ServeHTTP(record, req)
+	if cacheControl := record.Header().Get("Cache-Control"); cacheControl != "public, max-age=60" {
+		log.Fatalf("Unexcepted Cache-Control %s\n", cacheControl)
+	}
+}
+
+func TestFormatHandlers(t *testing.T) {
+	router := httpbin.GetMux()
+
+	cases := []struct {
+		path        string
+		contentType string
+		contains    string
+	}{
+		{"/html", "text/html; charset=utf-8", "Moby-Dick"},
+		{"/xml", "application/xml", "<slideshow"},
+		{"/json", "application/json", `"slideshow"`},
+		{"/robots.txt", "text/plain; charset=utf-8", "Disallow: /deny"},
+		{"/deny", "text/plain; charset=utf-8", "YOU SHOULDN'T BE HERE"},
+		{"/encoding/utf8", "text/html; charset=utf-8", "床前明月光"},
+		{"/image/png", "image/png", "PNG"},
+	}
+	for _, c := range cases {
+		req, err := http.NewRequest("GET", c.path, nil)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		record := httptest.NewRecorder()
+		router.ServeHTTP(record, req)
+
+		if record.Code != http.StatusOK || record.Header().Get("Content-Type") != c.contentType {
+			log.Fatalf("%s: Unexcepted response %v %s\n", c.path, record.Code, record.Header().Get("Content-Type"))
+		}
+		if !strings.Contains(record.Body.String(), c.contains) {
+			log.Fatalf("%s: Unexcepted body %s\n", c.path, record.Body.String())
+		}
+	}
+}
+
+func TestLinksHandler(t *testing.T) {
+	httpbin.TEMPLATE_DIR = "templates"
+	router := httpbin.GetMux()
+
+	req, err := http.NewRequest("GET", "/links/3", nil)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	record := httptest.NewRecorder()
+	router.ServeHTTP(record, req)
+	if record.Code != http.StatusFound || record.Header().Get("Location") != "/links/3/0" {
+		log.Fatalf("Unexcepted response %v %v\n", record.Code, record.Header())
+	}
+
+	req, err = http.NewRequest("GET", "/links/3/1", nil)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	record = httptest.NewRecorder()
+	router.ServeHTTP(record, req)
+	body := record.Body.String()
+	if record.Code != http.StatusOK || record.Header().Get("Content-Type") != "text/html; charset=utf-8" {
+		log.Fatalf("Unexcepted response %v %v\n", record.Code, record.Header())
+	}
+	if !strings.Contains(body, `<a href="/links/3/0">0</a> 1 <a href="/links/3/2">2</a>`) {
+		log.Fatalf("Unexcepted body %s\n", body)
+	}
+
+	req, err = http.NewRequest("GET", "/legacy", nil)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	record = httptest.NewRecorder()
+	router.ServeHTTP(record, req)
+	if record.Code != http.StatusOK || !strings.Contains(record.Body.String(), "<em>n</em>") {
+		log.Fatalf("Unexcepted index %v\n", record.Code)
+	}
+}
+
+func TestEnabledGroups(t *testing.T) {
+	groups, err := httpbin.ParseGroups([]string{"http-methods", "Request_Inspection"})
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if fmt.Sprint(groups) != "[HTTP Methods Request inspection]" {
+		log.Fatalf("Unexcepted groups %v\n", groups)
+	}
+	if _, err := httpbin.ParseGroups([]string{"nope"}); err == nil {
+		log.Fatalln("Excepted error for unknown group")
+	}
+
+	httpbin.ENABLED_GROUPS = groups
+	defer func() { httpbin.ENABLED_GROUPS = nil }()
+	router := httpbin.GetMux()
+
+	cases := map[string]int{
+		"/get":        http.StatusOK,
+		"/ip":         http.StatusOK,
+		"/cookies":    http.StatusNotFound,
+		"/status/200": http.StatusNotFound,
+		"/anything/x": http.StatusNotFound,
+		"/image/png":  http.StatusNotFound,
+	}
+	for path, code := range cases {
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		record := httptest.NewRecorder()
+		router.ServeHTTP(record, req)
+		if record.Code != code {
+			log.Fatalf("%s: Unexcepted code %d, excepted %d\n", path, record.Code, code)
+		}
+	}
+}
+
+func TestResponseLimits(t *testing.T) {
+	httpbin.MAX_BODY_SIZE = 10
+	httpbin.MAX_BYTES = 16
+	defer func() {
+		httpbin.MAX_BODY_SIZE = 10 << 20
+		httpbin.MAX_BYTES = 100 * 1024
+	}()
+	router := httpbin.GetMux()
+
+	for body, code := range map[string]int{"0123456789": http.StatusOK, "0123456789a": http.StatusRequestEntityTooLarge} {
+		req, err := http.NewRequest("POST", "/post", strings.NewReader(body))
+		if err != nil {
+			log.Fatalln(err)
+		}
+		record := httptest.NewRecorder()
+		router.ServeHTTP(record, req)
+		if record.Code != code {
+			log.Fatalf("Unexcepted code %d for %d bytes body, excepted %d\n", record.Code, len(body), code)
+		}
+	}
+
+	req, err := http.NewRequest("GET", "/bytes/1024", nil)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	record := httptest.NewRecorder()
+	router.ServeHTTP(record, req)
+	if record.Body.Len() != 16 {
+		log.Fatalf("Excepted /bytes to be capped at 16 bytes, got %d\n", record.Body.Len())
+	}
+}
+
 func TestImgHandler(t *testing.T) {
 	// TODO: 测试 /image 接口，判断返回的图片类型
 }